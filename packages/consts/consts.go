@@ -72,11 +72,80 @@ const TCP_PORT = "7078"
 const MAX_BLOCK_USER_TXS = 100
 const RB_BLOCKS_1 = 30
 const RB_BLOCKS_2 = 1440
+
+// блок считается окончательным, если его подтвердили не менее FINAL_CONFIRMED_NODES нодов
+// и подтвердивших не меньше, чем вдвое больше неподтвердивших. Ниже такого блока цепочку не откатываем
+const FINAL_CONFIRMED_NODES = 3
 const ALERT_ERROR_TIME = 1
 
 const DATA_TYPE_MAX_BLOCK_ID = 10
 const DATA_TYPE_BLOCK_BODY = 7
 
+// тела блоков с from по to за один запрос
+const DATA_TYPE_BLOCKS = 11
+
+// максимальное кол-во блоков и суммарный размер блоков в ответе на DATA_TYPE_BLOCKS
+const BLOCKS_BATCH_COUNT = 1000
+const BLOCKS_BATCH_SIZE = 10485760
+
+// сколько скачанных блоков может ожидать проверки
+const BLOCKS_PIPELINE = 100
+
+// обмен адресами нодов
+const DATA_TYPE_PEERS = 12
+
+// сколько адресов отдаем в ответ на DATA_TYPE_PEERS и сколько берем из адресной книги для синхронизации
+const PEERS_COUNT = 100
+
+// раз в сколько секунд опрашиваем ноды и снижаем на 1 ban_score
+const PEERS_PERIOD = 600
+
+// максимальное кол-во хостов в адресной книге
+const PEERS_MAX = 1000
+
+// сколько хостов, с которыми мы еще не соединялись, может добавить в адресную книгу один нод
+const PEERS_SOURCE_MAX = 50
+
+// через сколько секунд без успешного соединения хост удаляется из адресной книги
+const PEERS_EXPIRE = 86400 * 7
+
+// на сколько увеличивается ban_score за NodesBan и с какого значения хост не используется
+const BAN_SCORE = 10
+const MAX_BAN_SCORE = 100
+
+// первое сообщение соединения, в котором ноды обмениваются версией протокола и ключом нода
+const DATA_TYPE_HANDSHAKE = 20
+
+// после handshake соединение переходит в режим мультиплексирования запросов
+const DATA_TYPE_MUX = 21
+
+// версия протокола обмена между нодами и минимальная версия, с которой мы совместимы
+const PROTOCOL_VERSION = 2
+const MIN_PROTOCOL_VERSION = 1
+
+// допустимое расхождение времени в секундах при проверке подписи handshake
+const HANDSHAKE_PERIOD = 300
+
+// true включает прием соединений без handshake и соединение со старыми нодами без него.
+// включать только на время обновления нод, такие ноды не проверяются
+const LEGACY_TCP = false
+
+// максимальное кол-во входящих TCP-соединений
+const MAX_TCP_CONNECTIONS = 100
+
+// постоянные соединения в режиме мультиплексирования считаются отдельно от MAX_TCP_CONNECTIONS
+const MAX_MUX_CONNECTIONS = 100
+
+// максимальное кол-во входящих соединений с одного IP
+const MAX_HOST_CONNECTIONS = 10
+
+// максимальное кол-во одновременных запросов в одном соединении с нодом
+const PEER_STREAMS = 10
+
+// через сколько секунд шлем keepalive и через сколько секунд тишины закрываем соединение
+const PEER_PING = 30
+const PEER_IDLE = 90
+
 const CHANGE_KEY_PERIOD = 86400 * 7
 
 const UPD_FULL_NODES_PERIOD = 3600 // на время тестов 3600, потом надо ставить 86400
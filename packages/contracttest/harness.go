@@ -0,0 +1,161 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package contracttest allows to test the contracts without PostgreSQL. The contracts are compiled
+// from the source and are executed with the in-memory storage of the tables.
+// Only DB*, Emit and StateVal functions of the contracts work with the in-memory storage.
+//
+//	h := contracttest.New(1)
+//	defer h.Close()
+//	h.LoadFixtures(`fixtures.json`)
+//	h.Compile(`contract MyContract {...}`)
+//	res, err := h.Call(`MyContract`, wallet, map[string]interface{}{`Amount`: int64(10)})
+package contracttest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/parser"
+	"github.com/EGaaS/go-egaas-mvp/packages/script"
+	"github.com/EGaaS/go-egaas-mvp/packages/smart"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+	"github.com/shopspring/decimal"
+)
+
+// Harness executes the contracts of the state with the in-memory storage
+type Harness struct {
+	Storage *Storage
+	State   uint32
+	BlockID int64
+	prev    parser.Storage
+	tblID   int64
+	txCount int64
+}
+
+// Result is the result of the execution of the contract
+type Result struct {
+	Cost   int64                  // used cost of CPU resources
+	Fuel   decimal.Decimal        // Cost multiplied by fuel_rate
+	Price  int64                  // the result of price function or -1
+	Extend map[string]interface{} // the variables of the contract, for example, $result
+}
+
+// New creates the harness and sets its storage as the storage of the contracts until Close is called.
+// system_parameters table with fuel_rate = 1 is created by default.
+func New(state uint32) *Harness {
+	h := &Harness{Storage: NewStorage(), State: state, BlockID: 1}
+	h.Storage.Seed(`system_parameters`, &Table{Columns: map[string]string{`name`: `character varying`,
+		`value`: `text`}, Rows: []map[string]string{{`id`: `1`, `name`: `fuel_rate`, `value`: `1`}}})
+	h.prev = parser.SetStorage(h.Storage)
+	return h
+}
+
+// Close restores the previous storage of the contracts
+func (h *Harness) Close() {
+	parser.SetStorage(h.prev)
+}
+
+// Compile compiles the contracts of the state and activates them
+func (h *Harness) Compile(src string) error {
+	h.tblID++
+	prefix := `global`
+	if h.State > 0 {
+		prefix = utils.UInt32ToStr(h.State)
+	}
+	return smart.Compile(src, prefix, true, h.tblID)
+}
+
+// CompileFile compiles the contracts from the file
+func (h *Harness) CompileFile(fname string) error {
+	src, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	return h.Compile(string(src))
+}
+
+// Seed creates the table with the specified rows
+func (h *Harness) Seed(name string, table *Table) {
+	h.Storage.Seed(name, table)
+}
+
+// LoadFixtures creates the tables from JSON file like {"1_accounts": {"columns": {...}, "rows": [...]}}
+func (h *Harness) LoadFixtures(fname string) error {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	tables := make(map[string]*Table)
+	if err = json.Unmarshal(data, &tables); err != nil {
+		return err
+	}
+	for name, table := range tables {
+		h.Storage.Seed(name, table)
+	}
+	return nil
+}
+
+// Rows returns the rows of the table
+func (h *Harness) Rows(name string) []map[string]string {
+	if table, ok := h.Storage.Tables[name]; ok {
+		return table.Rows
+	}
+	return nil
+}
+
+// Call executes init, conditions and action functions of the contract on behalf of the wallet.
+// The fields of the contract which are missing in data get zero values.
+func (h *Harness) Call(name string, wallet int64, data map[string]interface{}) (*Result, error) {
+	contract := smart.GetContract(name, h.State)
+	if contract == nil {
+		return nil, fmt.Errorf(`unknown contract %s`, name)
+	}
+	h.txCount++
+	head := &consts.TXHeader{Type: int32(contract.Block.Info.(*script.ContractInfo).Id),
+		Time: uint32(time.Now().Unix()), WalletId: uint64(wallet), StateId: int32(h.State)}
+	p := &parser.Parser{TxPtr: head, TxContract: contract, TxStateID: h.State,
+		TxStateIDStr: utils.UInt32ToStr(h.State), TxTime: int64(head.Time),
+		TxHash:    hex.EncodeToString(utils.Int64ToByte(h.txCount)),
+		BlockData: &utils.BlockData{BlockId: h.BlockID, Time: int64(head.Time)},
+		TxData:    make(map[string]interface{})}
+	if h.State > 0 {
+		p.TxCitizenID = wallet
+	} else {
+		p.TxWalletID = wallet
+	}
+	if fields := contract.Block.Info.(*script.ContractInfo).Tx; fields != nil {
+		for _, field := range *fields {
+			if val, ok := data[field.Name]; ok {
+				p.TxData[field.Name] = val
+			} else {
+				p.TxData[field.Name] = reflect.Zero(field.Type).Interface()
+			}
+		}
+	}
+	err := p.RunContract(smart.CALL_INIT | smart.CALL_FRONT | smart.CALL_MAIN)
+	result := &Result{Price: contract.TxPrice, Cost: p.TxUsedCost.IntPart()}
+	if contract.Extend != nil {
+		result.Extend = *contract.Extend
+	}
+	result.Fuel = p.TxUsedCost.Mul(h.Storage.Fuel())
+	return result, err
+}
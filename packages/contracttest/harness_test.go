@@ -0,0 +1,90 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package contracttest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestHarness(t *testing.T) {
+	h := New(1)
+	defer h.Close()
+	if err := h.LoadFixtures(`testdata/accounts.json`); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Compile(`contract TestSend {
+		data {
+			Recipient int
+			Amount    money
+		}
+		func conditions {
+			if DBAmount(Table("accounts"), "citizen_id", $citizen) < $Amount {
+				warning "not enough money"
+			}
+		}
+		func action {
+			var event map
+			DBUpdateExt(Table("accounts"), "citizen_id", $citizen, "-amount", $Amount)
+			if DBIntExt(Table("accounts"), "id", $Recipient, "citizen_id") == 0 {
+				DBInsert(Table("accounts"), "citizen_id,amount", $Recipient, $Amount)
+			} else {
+				DBUpdateExt(Table("accounts"), "citizen_id", $Recipient, "+amount", $Amount)
+			}
+			event["to"] = $Recipient
+			Emit("send", event)
+			$result = StateVal("gov_account")
+		}
+	}
+	contract TestFix {
+		func action {
+			DBUpdate(Table("accounts"), 1, "citizen_id", 1)
+		}
+	}`); err != nil {
+		t.Fatal(err)
+	}
+	res, err := h.Call(`TestSend`, 100, map[string]interface{}{`Recipient`: int64(200), `Amount`: decimal.New(20, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Cost <= 0 || !res.Fuel.Equals(decimal.New(res.Cost, 0)) || res.Extend[`result`] != `100` {
+		t.Errorf(`wrong result %d %s %v`, res.Cost, res.Fuel, res.Extend[`result`])
+	}
+	if _, err = h.Call(`TestSend`, 100, map[string]interface{}{`Recipient`: int64(300), `Amount`: decimal.New(5, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.Call(`TestSend`, 200, map[string]interface{}{`Amount`: decimal.New(100, 0)}); err == nil ||
+		err.Error() != `!not enough money` {
+		t.Errorf(`wrong error %v`, err)
+	}
+	if _, err = h.Call(`TestFix`, 100, nil); err == nil || err.Error() != `Access denied` {
+		t.Errorf(`wrong error %v`, err)
+	}
+	var out string
+	for _, row := range h.Rows(`1_accounts`) {
+		out += fmt.Sprintf(`%s:%s;`, row[`citizen_id`], row[`amount`])
+	}
+	if out != `100:25;200:30;300:5;` {
+		t.Errorf(`wrong rows %s`, out)
+	}
+	if events := h.Rows(`events`); len(events) != 2 || events[1][`data`] != `{"to":300}` ||
+		events[1][`contract`] != `@1TestSend` {
+		t.Errorf(`wrong events %v`, events)
+	}
+}
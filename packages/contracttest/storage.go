@@ -0,0 +1,426 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package contracttest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/parser"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+	"github.com/shopspring/decimal"
+)
+
+// Table is the table of the in-memory storage. If Permissions is not nil then the table is custom.
+type Table struct {
+	Columns     map[string]string   `json:"columns"`     // the types of the columns
+	Indexes     []string            `json:"indexes"`     // the indexed columns except id
+	Permissions map[string]string   `json:"permissions"` // insert, general_update, new_column conditions
+	Update      map[string]string   `json:"update"`      // the conditions of the columns
+	Rows        []map[string]string `json:"rows"`
+	lastID      int64
+}
+
+// Storage keeps the tables in memory. It supports the conditions like
+// `column = $ and column > 'value'` with the operators =, !=, <>, <, >, <=, >=.
+type Storage struct {
+	Tables map[string]*Table
+}
+
+var (
+	reAnd  = regexp.MustCompile(`(?i)\s+and\s+`)
+	reCond = regexp.MustCompile(`^"?([A-Za-z_]\w*)"?\s*(=|!=|<>|<=|>=|<|>)\s*(\$|'(?:[^']|'')*'|-?[\d\.]+)$`)
+)
+
+// NewStorage returns the empty in-memory storage
+func NewStorage() *Storage {
+	return &Storage{Tables: make(map[string]*Table)}
+}
+
+// Seed creates the table or replaces the existing one
+func (s *Storage) Seed(name string, table *Table) {
+	if table.Rows == nil {
+		table.Rows = make([]map[string]string, 0)
+	}
+	table.lastID = 0
+	for _, row := range table.Rows {
+		if id := utils.StrToInt64(row[`id`]); id > table.lastID {
+			table.lastID = id
+		}
+	}
+	s.Tables[name] = table
+}
+
+func (s *Storage) table(name string) (*Table, error) {
+	table, ok := s.Tables[name]
+	if !ok {
+		return nil, fmt.Errorf(`relation "%s" does not exist`, name)
+	}
+	return table, nil
+}
+
+func (t *Table) checkColumn(column string) error {
+	if t.Columns == nil || column == `id` {
+		return nil
+	}
+	if _, ok := t.Columns[column]; !ok {
+		return fmt.Errorf(`column "%s" does not exist`, column)
+	}
+	return nil
+}
+
+type condition struct {
+	column string
+	oper   string
+	value  string
+}
+
+func paramToStr(param interface{}) string {
+	switch val := param.(type) {
+	case uint32:
+		return utils.Int64ToStr(int64(val))
+	case int32:
+		return utils.Int64ToStr(int64(val))
+	case uint64:
+		return utils.Int64ToStr(int64(val))
+	case bool:
+		return fmt.Sprint(val)
+	}
+	return utils.InterfaceToStr(param)
+}
+
+func (t *Table) parseWhere(where string, params []interface{}) ([]condition, error) {
+	ret := make([]condition, 0)
+	where = strings.TrimSpace(where)
+	if len(where) == 0 {
+		return ret, nil
+	}
+	var iparam int
+	for _, item := range reAnd.Split(where, -1) {
+		match := reCond.FindStringSubmatch(strings.TrimSpace(item))
+		if match == nil {
+			return nil, fmt.Errorf(`unsupported condition %s`, item)
+		}
+		if err := t.checkColumn(match[1]); err != nil {
+			return nil, err
+		}
+		cond := condition{column: match[1], oper: match[2], value: match[3]}
+		switch {
+		case cond.value == `$`:
+			if iparam >= len(params) {
+				return nil, fmt.Errorf(`there is not parameter for %s`, item)
+			}
+			cond.value = paramToStr(params[iparam])
+			iparam++
+		case cond.value[0] == '\'':
+			cond.value = strings.Replace(cond.value[1:len(cond.value)-1], `''`, `'`, -1)
+		}
+		ret = append(ret, cond)
+	}
+	return ret, nil
+}
+
+// compare compares the values as numbers if both of them are numbers
+func compare(left, right string) int {
+	if dleft, err := decimal.NewFromString(left); err == nil {
+		if dright, err := decimal.NewFromString(right); err == nil {
+			return dleft.Cmp(dright)
+		}
+	}
+	return strings.Compare(left, right)
+}
+
+func match(row map[string]string, conds []condition) bool {
+	for _, cond := range conds {
+		val, ok := row[cond.column]
+		if !ok {
+			return false
+		}
+		cmp := compare(val, cond.value)
+		switch cond.oper {
+		case `=`:
+			ok = cmp == 0
+		case `!=`, `<>`:
+			ok = cmp != 0
+		case `<`:
+			ok = cmp < 0
+		case `>`:
+			ok = cmp > 0
+		case `<=`:
+			ok = cmp <= 0
+		case `>=`:
+			ok = cmp >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Table) find(where string, params []interface{}) ([]map[string]string, error) {
+	conds, err := t.parseWhere(where, params)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]map[string]string, 0)
+	for _, row := range t.Rows {
+		if match(row, conds) {
+			ret = append(ret, row)
+		}
+	}
+	return ret, nil
+}
+
+// Update changes the rows in the same way as selectiveLoggingAndUpd but it doesn't write the rollback data
+func (s *Storage) Update(p *parser.Parser, name string, fields []string, values []interface{}, whereFields,
+	whereValues []string) (string, error) {
+	if p.BlockData == nil {
+		return ``, fmt.Errorf(`It is impossible to write to DB when Block is undefined`)
+	}
+	table, err := s.table(name)
+	if err != nil {
+		return ``, err
+	}
+	strValues := make([]string, len(values))
+	for i, v := range values {
+		if i >= len(fields) {
+			return ``, fmt.Errorf(`wrong number of the values`)
+		}
+		fields[i] = strings.TrimSpace(fields[i])
+		column := strings.TrimPrefix(strings.TrimLeft(fields[i], `+-`), `timestamp `)
+		if err = table.checkColumn(column); err != nil {
+			return ``, err
+		}
+		if table.Columns[column] == `bytea` {
+			if str, ok := v.(string); ok {
+				if vbyte, err := hex.DecodeString(str); err == nil {
+					v = vbyte
+				}
+			}
+			if bval, ok := v.([]byte); ok && table.Permissions != nil && len(bval) > 32 {
+				return ``, fmt.Errorf(`hash value cannot be larger than 32 bytes`)
+			}
+		}
+		strValues[i] = paramToStr(v)
+		if strValues[i] == `NULL` {
+			strValues[i] = ``
+		}
+	}
+	set := func(row map[string]string) error {
+		for i, field := range fields[:len(strValues)] {
+			switch {
+			case field[0] == '+' || field[0] == '-':
+				cur, _ := decimal.NewFromString(row[field[1:]])
+				val, err := decimal.NewFromString(strValues[i])
+				if err != nil {
+					return err
+				}
+				if field[0] == '-' {
+					row[field[1:]] = cur.Sub(val).String()
+				} else {
+					row[field[1:]] = cur.Add(val).String()
+				}
+			case strings.HasPrefix(field, `timestamp `):
+				row[field[len(`timestamp `):]] = strValues[i]
+			default:
+				row[field] = strValues[i]
+			}
+		}
+		return nil
+	}
+	var rows []map[string]string
+	if len(whereFields) > 0 {
+		conds := make([]condition, len(whereFields))
+		for i, field := range whereFields {
+			conds[i] = condition{column: field, oper: `=`, value: whereValues[i]}
+		}
+		for _, row := range table.Rows {
+			if match(row, conds) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		table.lastID++
+		row := map[string]string{`id`: utils.Int64ToStr(table.lastID)}
+		for column := range table.Columns {
+			row[column] = ``
+		}
+		for i, field := range whereFields {
+			row[field] = whereValues[i]
+		}
+		if err = set(row); err != nil {
+			return ``, err
+		}
+		table.Rows = append(table.Rows, row)
+		return row[`id`], nil
+	}
+	for _, row := range rows {
+		if err = set(row); err != nil {
+			return ``, err
+		}
+	}
+	return rows[0][`id`], nil
+}
+
+// Single returns the column of the first found row
+func (s *Storage) Single(name, column, where string, params ...interface{}) (string, error) {
+	table, err := s.table(name)
+	if err != nil {
+		return ``, err
+	}
+	column = strings.Trim(column, `"`)
+	if err = table.checkColumn(column); err != nil {
+		return ``, err
+	}
+	rows, err := table.find(where, params)
+	if err != nil || len(rows) == 0 {
+		return ``, err
+	}
+	return rows[0][column], nil
+}
+
+// GetAll returns the found rows
+func (s *Storage) GetAll(name string, columns []string, where, order string, offset, limit int64,
+	params ...interface{}) ([]map[string]string, error) {
+	table, err := s.table(name)
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range columns {
+		columns[i] = strings.Trim(strings.TrimSpace(column), `"`)
+		if columns[i] != `*` {
+			if err = table.checkColumn(columns[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	rows, err := table.find(where, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) > 0 {
+		desc := strings.HasSuffix(strings.ToLower(order), ` desc`)
+		order = strings.Trim(strings.Fields(order)[0], `"`)
+		sort.SliceStable(rows, func(i, j int) bool {
+			if desc {
+				return compare(rows[i][order], rows[j][order]) > 0
+			}
+			return compare(rows[i][order], rows[j][order]) < 0
+		})
+	}
+	if offset > int64(len(rows)) {
+		offset = int64(len(rows))
+	}
+	rows = rows[offset:]
+	if limit >= 0 && limit < int64(len(rows)) {
+		rows = rows[:limit]
+	}
+	ret := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		ret[i] = make(map[string]string)
+		for _, column := range columns {
+			if column == `*` {
+				for key, val := range row {
+					ret[i][key] = val
+				}
+			} else {
+				ret[i][column] = row[column]
+			}
+		}
+	}
+	return ret, nil
+}
+
+// IsIndex returns true for id and the columns from Indexes
+func (s *Storage) IsIndex(name, column string) (bool, error) {
+	table, err := s.table(name)
+	if err != nil {
+		return false, err
+	}
+	if column == `id` {
+		return true, nil
+	}
+	for _, index := range table.Indexes {
+		if index == column {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Storage) NumIndexes(name string) (int, error) {
+	table, err := s.table(name)
+	if err != nil {
+		return 0, err
+	}
+	return len(table.Indexes), nil
+}
+
+func (s *Storage) IsCustomTable(name string) (bool, error) {
+	table, ok := s.Tables[name]
+	return ok && table.Permissions != nil, nil
+}
+
+func (s *Storage) ColumnTypes(name string) (map[string]string, error) {
+	table, err := s.table(name)
+	if err != nil {
+		return nil, err
+	}
+	return table.Columns, nil
+}
+
+func (s *Storage) Permissions(name, key string) (map[string]string, error) {
+	table, err := s.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if key == `update` {
+		return table.Update, nil
+	} else if len(key) > 0 {
+		return nil, fmt.Errorf(`unknown permissions %s`, key)
+	}
+	return table.Permissions, nil
+}
+
+// StateParam returns the value from <state>_state_parameters table
+func (s *Storage) StateParam(state int64, name string) (string, error) {
+	return s.Single(utils.Int64ToStr(state)+`_state_parameters`, `value`, `name = $`, name)
+}
+
+// Balance returns the amount from dlt_wallets table
+func (s *Storage) Balance(wallet int64) (decimal.Decimal, error) {
+	balance, err := s.Single(`dlt_wallets`, `amount`, `wallet_id = $`, wallet)
+	if err != nil {
+		return decimal.New(0, 0), err
+	}
+	if len(balance) == 0 {
+		return decimal.New(0, 0), nil
+	}
+	return decimal.NewFromString(balance)
+}
+
+// Fuel returns fuel_rate from system_parameters table
+func (s *Storage) Fuel() decimal.Decimal {
+	fuel, _ := s.Single(`system_parameters`, `value`, `name = $`, `fuel_rate`)
+	ret, _ := decimal.NewFromString(fuel)
+	return ret
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package controllers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+)
+
+const AEvents = `ajax_events`
+
+type EventsJson struct {
+	Data   []map[string]string `json:"data"`
+	Latest int64               `json:"latest"` // id of the last returned event
+	Error  string              `json:"error"`
+}
+
+func init() {
+	newPage(AEvents, `json`)
+}
+
+// AjaxEvents returns the events which have been emitted by contracts.
+// The events can be filtered by block, state, contract and name. Use latest parameter to get the next events.
+func (c *Controller) AjaxEvents() interface{} {
+	result := EventsJson{Latest: utils.StrToInt64(c.r.FormValue("latest"))}
+	where := []string{`id > ?`}
+	args := []interface{}{result.Latest}
+	for _, field := range []string{`block_id`, `state_id`} {
+		if val := c.r.FormValue(strings.TrimSuffix(field, `_id`)); len(val) > 0 {
+			where = append(where, field+` = ?`)
+			args = append(args, utils.StrToInt64(val))
+		}
+	}
+	for _, field := range []string{`contract`, `name`} {
+		if val := c.r.FormValue(field); len(val) > 0 {
+			where = append(where, field+` = ?`)
+			args = append(args, val)
+		}
+	}
+	limit := utils.StrToInt(c.r.FormValue("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	events, err := c.GetAll(fmt.Sprintf(`SELECT id, block_id, tx_hash, state_id, contract, name, data FROM events
+		WHERE %s ORDER BY id LIMIT %d`, strings.Join(where, ` AND `), limit), -1, args...)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if events == nil {
+		events = []map[string]string{}
+	}
+	for _, event := range events {
+		event[`tx_hash`] = hex.EncodeToString([]byte(event[`tx_hash`]))
+		result.Latest = utils.StrToInt64(event[`id`])
+	}
+	result.Data = events
+	return result
+}
@@ -58,7 +58,9 @@ func App(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for name := range r.Form {
-		params[name] = r.FormValue(name)
+		if !textproc.IsReserved(name) {
+			params[name] = r.FormValue(name)
+		}
 	}
 
 	params[`name`] = page
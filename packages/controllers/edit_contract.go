@@ -19,6 +19,7 @@ package controllers
 import (
 	"encoding/json"
 	"github.com/EGaaS/go-egaas-mvp/packages/lib"
+	"github.com/EGaaS/go-egaas-mvp/packages/smart"
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
 	"regexp"
 )
@@ -41,6 +42,7 @@ type editContractPage struct {
 	TableName           string
 	StateId             int64
 	Global              string
+	Tables              *smart.ContractTables // the tables which are read and written by the contract
 }
 
 func (c *Controller) EditContract() (string, error) {
@@ -121,6 +123,10 @@ func (c *Controller) EditContract() (string, error) {
 			break
 		}
 	}
+	var tables *smart.ContractTables
+	if len(data[`name`]) > 0 {
+		tables = smart.GetContractTables(data[`name`], uint32(utils.StrToInt64(prefix)), true)
+	}
 	TemplateStr, err := makeTemplate("edit_contract", "editContract", &editContractPage{
 		Alert:               c.Alert,
 		Lang:                c.Lang,
@@ -137,6 +143,7 @@ func (c *Controller) EditContract() (string, error) {
 		Confirm:             c.SessWalletId == cont_wallet,
 		TxActivateType:      `ActivateContract`,
 		TxActivateTypeId:    utils.TypeInt(`ActivateContract`),
+		Tables:              tables,
 		StateId:             c.SessStateId})
 	if err != nil {
 		return "", utils.ErrInfo(err)
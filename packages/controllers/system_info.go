@@ -30,6 +30,7 @@ type systemInfoPage struct {
 	UpdFullNodes []map[string]string
 	MainLock []map[string]string
 	Rollback []map[string]string
+	ReorgLog []map[string]string
 	FullNodes []map[string]string
 	Votes []map[string]string
 	SystemParameters []map[string]string
@@ -58,6 +59,11 @@ func (c *Controller) SystemInfo() (string, error) {
 		return "", utils.ErrInfo(err)
 	}
 
+	pageData.ReorgLog, err = c.GetAll(`SELECT id, time, host, fork_block_id, depth, old_block_id, new_block_id, status, reason, error FROM reorg_log ORDER BY id DESC LIMIT 100`, -1)
+	if err != nil {
+		return "", utils.ErrInfo(err)
+	}
+
 	pageData.FullNodes, err = c.GetAll(`SELECT * FROM full_nodes`, -1)
 	if err != nil {
 		return "", utils.ErrInfo(err)
@@ -18,11 +18,13 @@ package controllers
 
 import (
 	"fmt"
+	"html"
 	"net/http"
 	"runtime/debug"
 	"strings"
 
 	"github.com/EGaaS/go-egaas-mvp/packages/lib"
+	"github.com/EGaaS/go-egaas-mvp/packages/textproc"
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
 )
 
@@ -57,7 +59,9 @@ func Template(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for name := range r.Form {
-		params[name] = r.FormValue(name)
+		if !textproc.IsReserved(name) {
+			params[name] = r.FormValue(name)
+		}
 	}
 	params[`global`] = lib.Escape(r.FormValue("global"))
 	params[`accept_lang`] = r.Header.Get(`Accept-Language`)
@@ -69,6 +73,15 @@ func Template(w http.ResponseWriter, r *http.Request) {
 	if err != nil || strings.HasPrefix(strings.TrimSpace(tpl),`NULL`) || len(tpl) == 0 {
 		tpl = `Something is wrong. <a href="#" onclick="load_page('editPage', {name: '` + page +
 			`', global:'` + params[`global`] + `'})">Edit page</a>`
+		table := utils.Int64ToStr(sessStateId) + `_pages`
+		if params[`global`] == `1` {
+			table = `global_pages`
+		}
+		if prog, _ := utils.GetPageTemplate(table, page); prog != nil {
+			for _, item := range prog.Validate() {
+				tpl += `<br>` + html.EscapeString(item.Error())
+			}
+		}
 	}
 	w.Write([]byte(tpl))
 	return
@@ -56,12 +56,18 @@ func BlocksCollection(chBreaker chan bool, chAnswer chan string) {
 	}
 	//var cur bool
 	var file *os.File
+	// закрываем, чтобы остановить фоновую закачку блоков
+	var stopDownload chan bool
 BEGIN:
 	for {
 		if file != nil {
 			file.Close()
 			file = nil
 		}
+		if stopDownload != nil {
+			close(stopDownload)
+			stopDownload = nil
+		}
 		logger.Info(GoroutineName)
 		MonitorDaemonCh <- []string{GoroutineName, utils.Int64ToStr(utils.Time())}
 
@@ -354,7 +360,8 @@ BEGIN:
 			if CheckDaemonsRestart(chBreaker, chAnswer, GoroutineName) {
 				break BEGIN
 			}
-			conn, err := utils.TcpConn(hosts[i] + ":" + consts.TCP_PORT)
+			// шлем тип данных
+			conn, err := utils.TcpRequest(hosts[i]+":"+consts.TCP_PORT, consts.DATA_TYPE_MAX_BLOCK_ID)
 			if err != nil {
 				if d.dPrintSleep(err, 1) {
 					break BEGIN
@@ -364,16 +371,6 @@ BEGIN:
 
 			logger.Debug("conn", conn)
 
-			// шлем тип данных
-			_, err = conn.Write(utils.DecToBin(consts.DATA_TYPE_MAX_BLOCK_ID, 2))
-			if err != nil {
-				conn.Close()
-				if d.dPrintSleep(err, 1) {
-					break BEGIN
-				}
-				continue
-			}
-
 			// в ответ получаем номер блока
 			blockIdBin := make([]byte, 4)
 			_, err = conn.Read(blockIdBin)
@@ -429,6 +426,10 @@ BEGIN:
 
 		fmt.Printf("\nnode: %s curid=%d maxid=%d\n", maxBlockIdHost, currentBlockId, maxBlockId)
 
+		// качаем блоки пачками в фоне, а проверяем их по мере получения
+		stopDownload = make(chan bool)
+		blocks := utils.DownloadBlocks(maxBlockIdHost, currentBlockId+1, maxBlockId, stopDownload)
+
 		/////----///////
 		// в цикле собираем блоки, пока не дойдем до максимального
 		for blockId := currentBlockId + 1; blockId < maxBlockId+1; blockId++ {
@@ -438,8 +439,9 @@ BEGIN:
 				break BEGIN
 			}
 
-			// качаем тело блока с хоста maxBlockIdHost
-			binaryBlock, err := utils.GetBlockBody(maxBlockIdHost, blockId, consts.DATA_TYPE_BLOCK_BODY)
+			// берем тело блока, скачанное с хоста maxBlockIdHost
+			block := <-blocks
+			binaryBlock, err := block.Data, block.Err
 
 			if len(binaryBlock) == 0 {
 				// баним на 1 час хост, который дал нам пустой блок, хотя должен был дать все до максимального
@@ -460,7 +462,7 @@ BEGIN:
 			// размер блока не может быть более чем max_block_size
 			if currentBlockId > 1 {
 				if int64(len(binaryBlock)) > consts.MAX_BLOCK_SIZE {
-					d.NodesBan(fmt.Sprintf(`len(binaryBlock) > variables.Int64["max_block_size"]  %v > %v`, len(binaryBlock), consts.MAX_BLOCK_SIZE))
+					d.NodesBan(maxBlockIdHost, fmt.Sprintf(`len(binaryBlock) > variables.Int64["max_block_size"]  %v > %v`, len(binaryBlock), consts.MAX_BLOCK_SIZE))
 					if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 						break BEGIN
 					}
@@ -471,7 +473,7 @@ BEGIN:
 			logger.Debug("currentBlockId %v", currentBlockId)
 
 			if blockData.BlockId != blockId {
-				d.NodesBan(fmt.Sprintf(`blockData.BlockId != blockId  %v > %v`, blockData.BlockId, blockId))
+				d.NodesBan(maxBlockIdHost, fmt.Sprintf(`blockData.BlockId != blockId  %v > %v`, blockData.BlockId, blockId))
 				if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 					break BEGIN
 				}
@@ -503,7 +505,7 @@ BEGIN:
 			// нам нужен меркель-рут текущего блока
 			mrklRoot, err := utils.GetMrklroot(binaryBlock, first)
 			if err != nil {
-				d.NodesBan(fmt.Sprintf(`%v`, err))
+				d.NodesBan(maxBlockIdHost, fmt.Sprintf(`%v`, err))
 				if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 					break BEGIN
 				}
@@ -543,10 +545,10 @@ BEGIN:
 					continue BEGIN
 				}
 				// нужно привести данные в нашей БД в соответствие с данными у того, у кого качаем более свежий блок
-				err := parser.GetOldBlocks(blockData.WalletId, blockData.CBID, blockId-1, maxBlockIdHost, GoroutineName, consts.DATA_TYPE_BLOCK_BODY)
+				err := parser.Reorg(maxBlockIdHost, blockId-1, consts.RB_BLOCKS_2, fmt.Sprintf(`block %d of %s doesn't match our chain, max block %d`, blockId, maxBlockIdHost, maxBlockId))
 				if err != nil {
 					logger.Error("%v", err)
-					d.NodesBan(fmt.Sprintf(`blockId: %v / %v`, blockId, err))
+					d.NodesBan(maxBlockIdHost, fmt.Sprintf(`blockId: %v / %v`, blockId, err))
 					if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 						break BEGIN
 					}
@@ -624,7 +626,7 @@ BEGIN:
 			if err != nil {
 				logger.Error("%v", err)
 				parser.BlockError(err)
-				d.NodesBan(fmt.Sprintf(`blockId: %v / %v`, blockId, err))
+				d.NodesBan(maxBlockIdHost, fmt.Sprintf(`blockId: %v / %v`, blockId, err))
 				if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 					break BEGIN
 				}
@@ -642,6 +644,9 @@ BEGIN:
 	if file != nil {
 		file.Close()
 	}
+	if stopDownload != nil {
+		close(stopDownload)
+	}
 
 	logger.Debug("break BEGIN %v", GoroutineName)
 }
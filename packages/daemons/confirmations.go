@@ -20,7 +20,6 @@ import (
 	"github.com/EGaaS/go-egaas-mvp/packages/consts"
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
 	"time"
-	"net"
 )
 
 /*
@@ -121,7 +120,7 @@ BEGIN:
 			if d.ConfigIni["test_mode"] == "1" {
 				hosts = []string{"localhost:"+consts.TCP_PORT}
 			} else {
-				hosts, err = d.GetHosts()
+				hosts, err = d.GetFullNodesHosts()
 				if err != nil {
 					logger.Error("%v", err)
 				}
@@ -178,29 +177,14 @@ BEGIN:
 func checkConf(host string, blockId int64) string {
 
 	logger.Debug("host: %v", host)
-	/*tcpAddr, err := net.ResolveTCPAddr("tcp", host)
-	if err != nil {
-		log.Error("%v", utils.ErrInfo(err))
-		return "0"
-	}
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)*/
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	// вначале шлем тип данных, чтобы принимающая сторона могла понять, как именно надо обрабатывать присланные данные
+	conn, err := utils.TcpRequest(host, 4)
 	if err != nil {
 		logger.Debug("%v", utils.ErrInfo(err))
 		return "0"
 	}
 	defer conn.Close()
 
-	conn.SetReadDeadline(time.Now().Add(consts.READ_TIMEOUT * time.Second))
-	conn.SetWriteDeadline(time.Now().Add(consts.WRITE_TIMEOUT * time.Second))
-
-	// вначале шлем тип данных, чтобы принимающая сторона могла понять, как именно надо обрабатывать присланные данные
-	_, err = conn.Write(utils.DecToBin(4, 2))
-	if err != nil {
-		logger.Error("%v", utils.ErrInfo(err))
-		return "0"
-	}
-
 	// в 4-х байтах пишем ID блока, хэш которого хотим получить
 	size := utils.DecToBin(blockId, 4)
 	_, err = conn.Write(size)
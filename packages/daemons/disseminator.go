@@ -66,7 +66,7 @@ BEGIN:
 
 
 
-		hosts, err := d.GetHosts()
+		hosts, err := d.GetFullNodesHosts()
 		if err != nil {
 			logger.Error("%v", err)
 		}
@@ -259,20 +259,13 @@ BEGIN:
 
 						logger.Debug("host %v", host)
 
-						conn, err := utils.TcpConn(host)
-						if err != nil {
-							logger.Error("%v", utils.ErrInfo(err))
-							return
-						}
-						defer conn.Close()
-
-
 						// вначале шлем тип данных, чтобы принимающая сторона могла понять, как именно надо обрабатывать присланные данные
-						_, err = conn.Write(utils.DecToBin(dataType, 2))
+						conn, err := utils.TcpRequest(host, dataType)
 						if err != nil {
 							logger.Error("%v", utils.ErrInfo(err))
 							return
 						}
+						defer conn.Close()
 
 						// в 4-х байтах пишем размер данных, которые пошлем далее
 						size := utils.DecToBin(len(toBeSent), 4)
@@ -307,24 +300,17 @@ func (d *daemon) DisseminatorType1(host string, toBeSent []byte, dataType int64)
 	logger.Debug("host %v", host)
 
 	// шлем данные указанному хосту
-	conn, err := utils.TcpConn(host)
-	if err != nil {
-		logger.Error("%v", utils.ErrInfo(err))
-		return
-	}
-	defer conn.Close()
-
 	// вначале шлем тип данных, чтобы принимающая сторона могла понять, как именно надо обрабатывать присланные данные
-	n, err := conn.Write(utils.DecToBin(dataType, 2))
+	conn, err := utils.TcpRequest(host, dataType)
 	if err != nil {
 		logger.Error("%v", utils.ErrInfo(err))
 		return
 	}
-	logger.Debug("n: %x (host : %v)", n, host)
+	defer conn.Close()
 
 	// в 4-х байтах пишем размер данных, которые пошлем далее
 	size := utils.DecToBin(len(toBeSent), 4)
-	n, err = conn.Write(size)
+	n, err := conn.Write(size)
 	if err != nil {
 		logger.Error("%v", utils.ErrInfo(err))
 		return
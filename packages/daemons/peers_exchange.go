@@ -0,0 +1,113 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package daemons
+
+import (
+	"fmt"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+)
+
+/*
+ * Обмен адресами нодов. Спрашиваем у известных нодов их адресные книги и сохраняем новые хосты в peers,
+ * затем пробуем соединиться с хостами, с которыми еще не соединялись. Недоступные хосты получают ban_score.
+ */
+
+func PeersExchange(chBreaker chan bool, chAnswer chan string) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("daemon Recovered", r)
+			panic(r)
+		}
+	}()
+
+	const GoroutineName = "PeersExchange"
+	d := new(daemon)
+	d.DCDB = DbConnect(chBreaker, chAnswer, GoroutineName)
+	if d.DCDB == nil {
+		return
+	}
+	d.goRoutineName = GoroutineName
+	d.chAnswer = chAnswer
+	d.chBreaker = chBreaker
+	d.sleepTime = consts.PEERS_PERIOD
+	if !d.CheckInstall(chBreaker, chAnswer, GoroutineName) {
+		return
+	}
+	d.DCDB = DbConnect(chBreaker, chAnswer, GoroutineName)
+	if d.DCDB == nil {
+		return
+	}
+
+BEGIN:
+	for {
+		logger.Info(GoroutineName)
+		MonitorDaemonCh <- []string{GoroutineName, utils.Int64ToStr(utils.Time())}
+
+		// проверим, не нужно ли нам выйти из цикла
+		if CheckDaemonsRestart(chBreaker, chAnswer, GoroutineName) {
+			break BEGIN
+		}
+
+		if len(*utils.FirstBlockHost) > 0 {
+			if err := d.AddPeers(``, []string{*utils.FirstBlockHost}); err != nil {
+				logger.Error("%v", err)
+			}
+		}
+		hosts, err := d.GetHosts()
+		if err != nil {
+			logger.Error("%v", err)
+		}
+		newHosts, err := d.GetNewPeers(consts.PEERS_COUNT)
+		if err != nil {
+			logger.Error("%v", err)
+		}
+		for _, host := range append(hosts, newHosts...) {
+			if CheckDaemonsRestart(chBreaker, chAnswer, GoroutineName) {
+				break BEGIN
+			}
+			peers, err := utils.RequestPeers(host + ":" + consts.TCP_PORT)
+			if err != nil {
+				// баним только за неверные данные, недоступный хост удаляем из адресной книги
+				switch err.(type) {
+				case *utils.ProtocolError:
+					d.NodesBan(host, fmt.Sprintf("%v", err))
+				case *utils.NotSupportedError:
+				default:
+					logger.Debug("%s: %v", host, err)
+					if err = d.PeerFailed(host); err != nil {
+						logger.Error("%v", err)
+					}
+				}
+				continue
+			}
+			logger.Debug("%s peers %v", host, peers)
+			if err = d.AddPeers(host, peers); err != nil {
+				logger.Error("%v", err)
+			}
+		}
+		if err = d.DecreaseBanScores(); err != nil {
+			logger.Error("%v", err)
+		}
+
+		if d.dSleep(d.sleepTime) {
+			break BEGIN
+		}
+	}
+	logger.Debug("break BEGIN %v", GoroutineName)
+}
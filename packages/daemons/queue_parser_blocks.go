@@ -23,16 +23,13 @@ import (
 	"github.com/EGaaS/go-egaas-mvp/packages/consts"
 )
 
-/* Берем блок. Если блок имеет лучший хэш, то ищем, в каком блоке у нас пошла вилка
- * Если вилка пошла менее чем variables->rollback_blocks блоков назад, то
- *  - получаем всю цепочку блоков,
- *  - откатываем фронтальные данные от наших блоков,
- *  - заносим фронт. данные из новой цепочки
- *  - если нет ошибок, то откатываем наши данные из блоков
- *  - и заносим новые данные
- *  - если где-то есть ошибки, то откатываемся к нашим прежним данным
- * Если вилка была давно, то ничего не трогаем, и оставлеяем скрипту blocks_collection.php
- * Ограничение variables->rollback_blocks нужно для защиты от подставных блоков
+/* Выбираем из queue_blocks лучшую цепочку по правилам parser.ChooseTip: более длинная, а при равной длине -
+ * с меньшим хэшем последнего блока. Если она лучше нашей, то parser.Reorg
+ *  - качает блоки этой цепочки, пока не найдет общий с нами блок,
+ *  - откатывает наши блоки через RollbackToBlockId и заносит новые,
+ *  - если где-то есть ошибки, то возвращает наши прежние блоки
+ * Откат ниже окончательного блока (см. FINAL_CONFIRMED_NODES) не делается. Каждая реорганизация пишется в reorg_log
+ * Если мы отстали более чем на rollback_blocks_1 блоков, то ничего не трогаем, и оставляем демону BlocksCollection
  *
  * */
 
@@ -84,72 +81,59 @@ BEGIN:
 			continue BEGIN
 		}
 
-		prevBlockData, err := d.OneRow("SELECT * FROM info_block").String()
+		prevBlockId, err := d.GetBlockId()
 		if err != nil {
 			if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 				break BEGIN
 			}
 			continue BEGIN
 		}
-		newBlockData, err := d.OneRow("SELECT * FROM queue_blocks").String()
+
+		// выбираем лучшую из цепочек, о которых нам сообщили другие ноды. Проигравшие удаляются из queue_blocks
+		p := new(parser.Parser)
+		p.DCDB = d.DCDB
+		p.GoroutineName = GoroutineName
+		tip, reason, err := p.BestTip()
 		if err != nil {
 			if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 				break BEGIN
 			}
 			continue BEGIN
 		}
-		if len(newBlockData) == 0 {
+		if tip == nil {
 			if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 				break BEGIN
 			}
 			continue BEGIN
 		}
-		newBlockData["hash_hex"] = string(utils.BinToHex(newBlockData["hash"]))
-		prevBlockData["hash_hex"] = string(utils.BinToHex(prevBlockData["hash"]))
+		hashHex := string(utils.BinToHex(tip.Hash))
 
-		/*
-		 * Базовая проверка
-		 */
-
-		// проверим, укладывается ли блок в лимит rollback_blocks_1
-		if utils.StrToInt64(newBlockData["block_id"]) > utils.StrToInt64(prevBlockData["block_id"])+consts.RB_BLOCKS_1 {
-			d.DeleteQueueBlock(newBlockData["hash_hex"])
+		// если мы сильно отстали, то блоки соберет blocks_collection
+		if tip.BlockId > prevBlockId+consts.RB_BLOCKS_1 {
+			d.DeleteQueueBlock(hashHex)
 			if d.unlockPrintSleep(utils.ErrInfo("rollback_blocks_1"), 1) {
 				break BEGIN
 			}
 			continue BEGIN
 		}
 
-		// проверим не старый ли блок в очереди
-		if utils.StrToInt64(newBlockData["block_id"]) <= utils.StrToInt64(prevBlockData["block_id"]) {
-			d.DeleteQueueBlock(newBlockData["hash_hex"])
-			if d.unlockPrintSleepInfo(utils.ErrInfo("old block"), 1) {
-				break BEGIN
-			}
-			continue BEGIN
-		}
-
 		/*
 		 * Загрузка блоков для детальной проверки
 		 */
-		host, err := d.Single("SELECT host FROM full_nodes WHERE id = ?", newBlockData["full_node_id"]).String()
+		host, err := d.Single("SELECT host FROM full_nodes WHERE id = ?", tip.FullNodeId).String()
 		if err != nil {
-			d.DeleteQueueBlock(newBlockData["hash_hex"])
+			d.DeleteQueueBlock(hashHex)
 			if d.unlockPrintSleep(utils.ErrInfo(err), d.sleepTime) {
 				break BEGIN
 			}
 			continue BEGIN
 		}
-		blockId := utils.StrToInt64(newBlockData["block_id"])
 
-		p := new(parser.Parser)
-		p.DCDB = d.DCDB
-		p.GoroutineName = GoroutineName
-		err = p.GetBlocks(blockId, host+":"+consts.TCP_PORT, "rollback_blocks_1", GoroutineName, 7)
+		err = p.Reorg(host+":"+consts.TCP_PORT, tip.BlockId, consts.RB_BLOCKS_1, reason)
+		d.DeleteQueueBlock(hashHex)
 		if err != nil {
 			logger.Error("v", err)
-			d.DeleteQueueBlock(newBlockData["hash_hex"])
-			d.NodesBan(fmt.Sprintf("%v", err))
+			d.NodesBan(host, fmt.Sprintf("%v", err))
 			if d.unlockPrintSleep(utils.ErrInfo(err), 1) {
 				break BEGIN
 			}
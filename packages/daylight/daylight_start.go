@@ -93,6 +93,7 @@ func Start(dir string, thrustWindowLoder *window.Window) {
 	log.Debug("dcVersion: %v", consts.VERSION)
 
 	exchangeapi.InitApi()
+	go exchangeapi.Webhooks()
 
 	// читаем config.ini
 	configIni := make(map[string]string)
@@ -393,10 +394,17 @@ func Start(dir string, thrustWindowLoder *window.Window) {
 		http.HandleFunc(HandleHttpHost+"/app", controllers.App)
 		http.HandleFunc(HandleHttpHost+"/ajax", controllers.Ajax)
 		http.HandleFunc(HandleHttpHost+"/wschain", controllers.WsBlockchain)
-		http.HandleFunc(HandleHttpHost+"/exchangeapi/newkey", exchangeapi.Api)
-		http.HandleFunc(HandleHttpHost+"/exchangeapi/send", exchangeapi.Api)
-		http.HandleFunc(HandleHttpHost+"/exchangeapi/balance", exchangeapi.Api)
-		http.HandleFunc(HandleHttpHost+"/exchangeapi/history", exchangeapi.Api)
+		if len(*utils.ApiHost) > 0 {
+			apiMux := http.NewServeMux()
+			exchangeapi.Register(apiMux, ``)
+			go func() {
+				if err := http.ListenAndServe(*utils.ApiHost, apiMux); err != nil {
+					log.Error("exchangeapi listener", err)
+				}
+			}()
+		} else {
+			exchangeapi.Register(http.DefaultServeMux, HandleHttpHost)
+		}
 		//http.HandleFunc(HandleHttpHost+"/ajaxjson", controllers.AjaxJson)
 		//http.HandleFunc(HandleHttpHost+"/tools", controllers.Tools)
 		//http.Handle(HandleHttpHost+"/public/", noDirListing(http.FileServer(http.Dir(*utils.Dir))))
@@ -408,10 +416,9 @@ func Start(dir string, thrustWindowLoder *window.Window) {
 			httpsMux.HandleFunc(HandleHttpHost+"/content", controllers.Content)
 			httpsMux.HandleFunc(HandleHttpHost+"/ajax", controllers.Ajax)
 			httpsMux.HandleFunc(HandleHttpHost+"/wschain", controllers.WsBlockchain)
-			httpsMux.HandleFunc(HandleHttpHost+"/exchangeapi/newkey", exchangeapi.Api)
-			httpsMux.HandleFunc(HandleHttpHost+"/exchangeapi/send", exchangeapi.Api)
-			httpsMux.HandleFunc(HandleHttpHost+"/exchangeapi/balance", exchangeapi.Api)
-			httpsMux.HandleFunc(HandleHttpHost+"/exchangeapi/history", exchangeapi.Api)
+			if len(*utils.ApiHost) == 0 {
+				exchangeapi.Register(httpsMux, HandleHttpHost)
+			}
 			httpsMux.Handle(HandleHttpHost+"/static/", http.FileServer(&assetfs.AssetFS{Asset: FileAsset, AssetDir: static.AssetDir, Prefix: ""}))
 			go http.ListenAndServeTLS(":443", *utils.Tls+`/fullchain.pem`, *utils.Tls+`/privkey.pem`, httpsMux)
 		}
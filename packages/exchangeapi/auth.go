@@ -0,0 +1,235 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package exchangeapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// SIGN_PERIOD is the maximum difference in seconds between the time of the signed request and the current time
+	SIGN_PERIOD = 300
+	// AUTH_FAILURES is the count of the failed authentications per minute from one address which are written
+	// to the audit log. The next requests from this address are rejected without writing.
+	AUTH_FAILURES = 10
+	// MAX_REMOTES is the maximum count of the addresses in the limits of the failed authentications
+	MAX_REMOTES = 10000
+)
+
+var (
+	audit = []byte(`Audit`)
+
+	limits = struct {
+		sync.Mutex
+		list map[string]*rateLimit
+	}{list: make(map[string]*rateLimit)}
+
+	failures = struct {
+		sync.Mutex
+		list map[string]*rateLimit
+	}{list: make(map[string]*rateLimit)}
+)
+
+// rateLimit is the bucket of the requests of the token. It is refilled by apiRate requests per minute.
+type rateLimit struct {
+	count float64
+	last  time.Time
+}
+
+// take refills the bucket by rate requests per minute and takes one request from it
+func (limit *rateLimit) take(rate float64, now time.Time) bool {
+	limit.count += now.Sub(limit.last).Minutes() * rate
+	if limit.count > rate {
+		limit.count = rate
+	}
+	limit.last = now
+	if limit.count < 1 {
+		return false
+	}
+	limit.count--
+	return true
+}
+
+// AuditItem is the record about the request to exchangeapi
+type AuditItem struct {
+	Time   int64             `json:"time"`
+	Token  string            `json:"token"`
+	Remote string            `json:"remote"`
+	Path   string            `json:"path"`
+	Params map[string]string `json:"params"`
+	Error  string            `json:"error"`
+}
+
+// tokens returns the list of the allowed tokens. -apiToken can contain several tokens separated by commas.
+func tokens() []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(*utils.ApiToken, `,`) {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// tokenId returns the identifier of the token which is used in the rate limits and the audit log
+func tokenId(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:4])
+}
+
+// signRequest returns HMAC-SHA256 signature of the request. The signed data is the path, the time and
+// the sorted parameters of the request except sign.
+func signRequest(token string, r *http.Request) string {
+	keys := make([]string, 0, len(r.Form))
+	for key := range r.Form {
+		if key != `sign` && key != `token` {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	data := r.URL.Path
+	for _, key := range keys {
+		data += "\n" + key + `=` + r.FormValue(key)
+	}
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticate checks the token or the signature of the request and returns the identifier of the token.
+// The token is sent in token parameter or in X-Api-Token header. The signed request has time and sign parameters.
+func authenticate(r *http.Request) (string, error) {
+	list := tokens()
+	if len(list) == 0 {
+		return ``, fmt.Errorf(`-apiToken is not defined`)
+	}
+	token := r.FormValue(`token`)
+	if len(token) == 0 {
+		token = r.Header.Get(`X-Api-Token`)
+	}
+	if len(token) > 0 {
+		for _, item := range list {
+			if hmac.Equal([]byte(token), []byte(item)) {
+				return tokenId(item), nil
+			}
+		}
+		return ``, fmt.Errorf(`Invalid token`)
+	}
+	sign := r.FormValue(`sign`)
+	if len(sign) == 0 {
+		return ``, fmt.Errorf(`Token or sign is required`)
+	}
+	if dif := time.Now().Unix() - utils.StrToInt64(r.FormValue(`time`)); dif > SIGN_PERIOD || dif < -SIGN_PERIOD {
+		return ``, fmt.Errorf(`Invalid time of the request`)
+	}
+	for _, item := range list {
+		if hmac.Equal([]byte(sign), []byte(signRequest(item, r))) {
+			return tokenId(item), nil
+		}
+	}
+	return ``, fmt.Errorf(`Invalid sign`)
+}
+
+// allowRequest returns false if the token has exceeded -apiRate requests per minute
+func allowRequest(id string) bool {
+	rate := float64(*utils.ApiRate)
+	if rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	limits.Lock()
+	defer limits.Unlock()
+	limit, ok := limits.list[id]
+	if !ok {
+		limit = &rateLimit{count: rate, last: now}
+		limits.list[id] = limit
+	}
+	return limit.take(rate, now)
+}
+
+// allowFailure returns false if the remote address has exceeded AUTH_FAILURES failed authentications per minute
+func allowFailure(r *http.Request) bool {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	now := time.Now()
+	failures.Lock()
+	defer failures.Unlock()
+	limit, ok := failures.list[remote]
+	if !ok {
+		if len(failures.list) >= MAX_REMOTES {
+			failures.list = make(map[string]*rateLimit)
+		}
+		limit = &rateLimit{count: AUTH_FAILURES, last: now}
+		failures.list[remote] = limit
+	}
+	return limit.take(AUTH_FAILURES, now)
+}
+
+// auditRequest saves the information about the request in Audit bucket. The key is the sequence number of the record.
+func auditRequest(r *http.Request, id string, errText string) {
+	item := AuditItem{Time: time.Now().Unix(), Token: id, Remote: r.RemoteAddr, Path: r.URL.Path,
+		Params: make(map[string]string), Error: errText}
+	for key := range r.Form {
+		if key != `token` && key != `sign` {
+			item.Params[key] = r.FormValue(key)
+		}
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		log.Error(`exchangeapi audit`, err)
+		return
+	}
+	err = boltDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(audit)
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return b.Put(key, data)
+	})
+	if err != nil {
+		log.Error(`exchangeapi audit`, err)
+	}
+}
+
+// Register adds the handlers of exchangeapi to mux
+func Register(mux *http.ServeMux, host string) {
+	for _, name := range []string{`newkey`, `send`, `balance`, `history`, `status`} {
+		mux.HandleFunc(host+`/exchangeapi/`+name, Api)
+	}
+}
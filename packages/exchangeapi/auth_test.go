@@ -0,0 +1,68 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package exchangeapi
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Now()
+	limit := &rateLimit{count: 2, last: now}
+	if !limit.take(2, now) || !limit.take(2, now) || limit.take(2, now) {
+		t.Errorf(`wrong count of the requests`)
+	}
+	if !limit.take(2, now.Add(30*time.Second)) || limit.take(2, now.Add(30*time.Second)) {
+		t.Errorf(`the bucket has not been refilled`)
+	}
+	if limit.take(2, now.Add(10*time.Minute)); limit.count != 1 {
+		t.Errorf(`the bucket has been overfilled %v`, limit.count)
+	}
+}
+
+func TestAuthFailures(t *testing.T) {
+	r := &http.Request{RemoteAddr: `10.1.2.3:5000`}
+	for i := 0; i < AUTH_FAILURES; i++ {
+		if !allowFailure(r) {
+			t.Errorf(`failure %d has been rejected`, i)
+		}
+	}
+	r.RemoteAddr = `10.1.2.3:5001`
+	if allowFailure(r) {
+		t.Errorf(`the limit of the address has been exceeded`)
+	}
+	if !allowFailure(&http.Request{RemoteAddr: `10.1.2.4:5000`}) {
+		t.Errorf(`the other address has been rejected`)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	r := &http.Request{URL: &url.URL{Path: `/exchangeapi/balance`},
+		Form: url.Values{`wallet`: {`123`}, `time`: {`1500000000`}, `sign`: {`any`}}}
+	sign := signRequest(`secret`, r)
+	r.Form.Set(`sign`, `other`)
+	if signRequest(`secret`, r) != sign {
+		t.Errorf(`sign parameter has been signed`)
+	}
+	r.Form.Set(`wallet`, `124`)
+	if signRequest(`secret`, r) == sign || signRequest(`other`, r) == signRequest(`secret`, r) {
+		t.Errorf(`wrong signature`)
+	}
+}
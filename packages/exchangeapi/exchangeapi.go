@@ -37,6 +37,7 @@ var (
 	boltDB   *bolt.DB
 	bucket   = []byte(`Keys`)
 	settings = []byte(`Settings`)
+	requests = []byte(`Requests`)
 	log      = logging.MustGetLogger("exchangeapi")
 )
 
@@ -190,13 +191,27 @@ func Api(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	r.ParseForm()
 
-	token := r.FormValue("token")
-	if len(*utils.ApiToken) > 0 && token != *utils.ApiToken {
-		w.Write([]byte(`{"error": "Invalid token"}`))
+	id, err := authenticate(r)
+	if err != nil {
+		if !allowFailure(r) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			writeError(w, `Too many requests`)
+			return
+		}
+		auditRequest(r, ``, err.Error())
+		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, err.Error())
+		return
+	}
+	if !allowRequest(id) {
+		auditRequest(r, id, `Too many requests`)
+		w.WriteHeader(http.StatusTooManyRequests)
+		writeError(w, `Too many requests`)
 		return
 	}
 	if len(*utils.BoltPsw) == 0 {
-		w.Write([]byte(`{"error": "-boltPsw password is not defined"}`))
+		auditRequest(r, id, `-boltPsw password is not defined`)
+		writeError(w, `-boltPsw password is not defined`)
 		return
 	}
 	var ret interface{}
@@ -204,17 +219,27 @@ func Api(w http.ResponseWriter, r *http.Request) {
 	case `/exchangeapi/newkey`:
 		ret = newKey(r)
 	case `/exchangeapi/send`:
-		ret = send(r)
+		ret = send(r, id)
 	case `/exchangeapi/balance`:
 		ret = balance(r)
 	case `/exchangeapi/history`:
 		ret = history(r)
+	case `/exchangeapi/status`:
+		ret = status(r, id)
 	default:
 		ret = DefaultApi{`Unknown request`}
 	}
 	jsonData, err := json.Marshal(ret)
 	if err != nil {
-		ret = DefaultApi{err.Error()}
+		jsonData, _ = json.Marshal(DefaultApi{err.Error()})
 	}
+	var result DefaultApi
+	json.Unmarshal(jsonData, &result)
+	auditRequest(r, id, result.Error)
+	w.Write(jsonData)
+}
+
+func writeError(w http.ResponseWriter, msg string) {
+	jsonData, _ := json.Marshal(DefaultApi{msg})
 	w.Write(jsonData)
 }
@@ -17,105 +17,142 @@
 package exchangeapi
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/EGaaS/go-egaas-mvp/packages/lib"
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
-	"github.com/shopspring/decimal"
 )
 
+const (
+	// HISTORY_COUNT is the default count of the operations in the response of history
+	HISTORY_COUNT = 50
+	// HISTORY_MAX is the maximum count of the operations in the response of history
+	HISTORY_MAX = 500
+	// histColumns are the columns of dlt_transactions which are used in HistOper
+	histColumns = `id, block_id, encode(tx_hash, 'hex') as hash, sender_wallet_id, recipient_wallet_id, amount,
+	commission, comment, time`
+)
+
+// HistOper is the transfer from dlt_transactions. Direction is in for the deposits and out for the withdrawals.
 type HistOper struct {
-	BlockId string `json:"block_id"`
-	Dif     string `json:"dif"`
-	Amount  string `json:"amount"`
-	EGS     string `json:"egs"`
-	Time    string `json:"time"`
-	//	Wallet  string `json:"wallet"`
+	Id         int64  `json:"id"`
+	BlockId    int64  `json:"block_id"`
+	Hash       string `json:"hash"`
+	Direction  string `json:"direction"`
+	Sender     string `json:"sender"`
+	Recipient  string `json:"recipient"`
+	Amount     string `json:"amount"`
+	EGS        string `json:"egs"`
+	Commission string `json:"commission"`
+	Comment    string `json:"comment"`
+	Time       string `json:"time"`
+	Timestamp  int64  `json:"timestamp"`
 }
 
+// History is the page of the operations. Next is the cursor for the next page, 0 means the last page.
 type History struct {
 	Error string     `json:"error"`
 	Items []HistOper `json:"history"`
+	Next  int64      `json:"next"`
+}
+
+// histOper converts the row of dlt_transactions to HistOper for the specified wallet
+func histOper(item map[string]string, wallet int64) HistOper {
+	sender := utils.StrToInt64(item[`sender_wallet_id`])
+	op := HistOper{Id: utils.StrToInt64(item[`id`]), BlockId: utils.StrToInt64(item[`block_id`]),
+		Hash: item[`hash`], Direction: `in`, Sender: lib.AddressToString(uint64(sender)),
+		Recipient: lib.AddressToString(uint64(utils.StrToInt64(item[`recipient_wallet_id`]))),
+		Amount:    item[`amount`], EGS: lib.EGSMoney(item[`amount`]), Commission: item[`commission`],
+		Comment: item[`comment`], Timestamp: utils.StrToInt64(item[`time`])}
+	if sender == wallet {
+		op.Direction = `out`
+	}
+	op.Time = time.Unix(op.Timestamp, 0).Format(`02.01.2006 15:04:05`)
+	return op
 }
 
+// history returns the transfers of the wallet. The parameters are
+//
+//	wallet - the address of the wallet
+//	count - the count of the operations on the page
+//	cursor - the value of next from the previous page
+//	type - in, out or empty for all operations
+//	time_from, time_to, block_from, block_to - the ranges of the time and the blocks
+//	since_block - the deposits which were included in the blocks after the specified block.
+//
+// The operations are returned in the descending order, if since_block is specified they are returned in
+// the ascending order.
 func history(r *http.Request) interface{} {
-	var (
-		result History
-	)
+	var result History
 
 	wallet := lib.StringToAddress(r.FormValue(`wallet`))
 	if wallet == 0 {
 		result.Error = `Wallet is invalid`
 		return result
 	}
-	count := int(utils.StrToInt64(r.FormValue(`count`)))
-	if count == 0 {
-		count = 50
+	count := utils.StrToInt64(r.FormValue(`count`))
+	if count <= 0 {
+		count = HISTORY_COUNT
 	}
-	if count > 200 {
-		count = 200
+	if count > HISTORY_MAX {
+		count = HISTORY_MAX
 	}
-	list := make([]HistOper, 0)
-	current, err := utils.DB.OneRow(`select amount, rb_id from dlt_wallets where wallet_id=?`, wallet).String()
-	if err != nil {
-		result.Error = err.Error()
+	order := `desc`
+	cond := make([]string, 0)
+	args := make([]interface{}, 0)
+	where := func(query string, value interface{}) {
+		cond = append(cond, query)
+		args = append(args, value)
+	}
+	oper := r.FormValue(`type`)
+	if since := r.FormValue(`since_block`); len(since) > 0 {
+		oper = `in`
+		order = `asc`
+		where(`block_id > ?`, utils.StrToInt64(since))
+	}
+	switch oper {
+	case `in`:
+		where(`recipient_wallet_id = ?`, wallet)
+	case `out`:
+		where(`sender_wallet_id = ?`, wallet)
+	case ``:
+		cond = append(cond, `(sender_wallet_id = ? OR recipient_wallet_id = ?)`)
+		args = append(args, wallet, wallet)
+	default:
+		result.Error = `Type is invalid`
 		return result
 	}
-	rb := utils.StrToInt64(current[`rb_id`])
-	if len(current) > 0 && rb != 0 {
-		balance, _ := decimal.NewFromString(current[`amount`])
-		for len(list) < count && rb > 0 {
-			var data map[string]string
-			prev, err := utils.DB.OneRow(`select r.*, b.time from rollback as r
-			left join block_chain as b on b.id=r.block_id
-			where r.rb_id=?`, rb).String()
-			if err != nil {
-				result.Error = err.Error()
-				return result
-			}
-			if err = json.Unmarshal([]byte(prev[`data`]), &data); err != nil {
-				result.Error = err.Error()
-				return result
-			}
-			rb = utils.StrToInt64(data[`rb_id`])
-			//			fmt.Println(`DATA`, prev)
-			if amount, ok := data[`amount`]; ok {
-				var dif decimal.Decimal
-				val, _ := decimal.NewFromString(amount)
-				if balance.Cmp(val) > 0 {
-					dif = balance.Sub(val)
-				} else {
-					dif = val.Sub(balance)
-				}
-				sign := `+`
-				if balance.Cmp(val) < 0 {
-					sign = `-`
-				}
-				dt := time.Unix(utils.StrToInt64(prev[`time`]), 0)
-
-				list = append(list, HistOper{BlockId: prev[`block_id`], Dif: sign + lib.EGSMoney(dif.String()),
-					Amount: balance.String(), EGS: lib.EGSMoney(balance.String()), Time: dt.Format(`02.01.2006 15:04:05`)})
-				balance = val
-
-			}
+	if cursor := utils.StrToInt64(r.FormValue(`cursor`)); cursor > 0 {
+		if order == `asc` {
+			where(`id > ?`, cursor)
+		} else {
+			where(`id < ?`, cursor)
 		}
 	}
-	if rb == 0 {
-		first, err := utils.DB.OneRow(`select * from dlt_transactions where recipient_wallet_id=? order by id`, wallet).String()
-		if err != nil {
-			result.Error = err.Error()
-			return result
-		}
-		if len(first) > 0 {
-			dt := time.Unix(utils.StrToInt64(first[`time`]), 0)
-			list = append(list, HistOper{BlockId: first[`block_id`], Dif: `+` + lib.EGSMoney(first[`amount`]),
-				Amount: first[`amount`],
-				EGS:    lib.EGSMoney(first[`amount`]), Time: dt.Format(`02.01.2006 15:04:05`)})
+	for _, item := range []struct {
+		par   string
+		query string
+	}{{`time_from`, `time >= ?`}, {`time_to`, `time <= ?`},
+		{`block_from`, `block_id >= ?`}, {`block_to`, `block_id <= ?`}} {
+		if val := r.FormValue(item.par); len(val) > 0 {
+			where(item.query, utils.StrToInt64(val))
 		}
 	}
-	result.Items = list
-
+	list, err := utils.DB.GetAll(fmt.Sprintf(`SELECT %s FROM dlt_transactions WHERE %s ORDER BY id %s LIMIT %d`,
+		histColumns, strings.Join(cond, ` AND `), order, count), -1, args...)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Items = make([]HistOper, 0, len(list))
+	for _, item := range list {
+		result.Items = append(result.Items, histOper(item, wallet))
+	}
+	if int64(len(list)) == count {
+		result.Next = result.Items[len(list)-1].Id
+	}
 	return result
 }
@@ -0,0 +1,40 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package exchangeapi
+
+import (
+	"testing"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/lib"
+)
+
+func TestHistOper(t *testing.T) {
+	sender := int64(-100)
+	item := map[string]string{`id`: `15`, `block_id`: `120`, `hash`: `abcd`, `sender_wallet_id`: `-100`,
+		`recipient_wallet_id`: `200`, `amount`: `1500000000000000000`, `commission`: `10`, `comment`: `order`,
+		`time`: `1500000000`}
+	op := histOper(item, sender)
+	if op.Id != 15 || op.BlockId != 120 || op.Direction != `out` || op.EGS != `1.5` || op.Timestamp != 1500000000 {
+		t.Errorf(`wrong operation %v`, op)
+	}
+	if op.Sender != lib.AddressToString(uint64(sender)) || op.Recipient != `0000-0000-0000-0000-0200` {
+		t.Errorf(`wrong wallets %s %s`, op.Sender, op.Recipient)
+	}
+	if op = histOper(item, 200); op.Direction != `in` {
+		t.Errorf(`wrong direction %s`, op.Direction)
+	}
+}
@@ -18,6 +18,7 @@ package exchangeapi
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -29,11 +30,81 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// REQUEST_TIMEOUT is the time in seconds after which request_id without the hash of the transaction can be
+// used again. It happens if the process has been stopped during the sending.
+const REQUEST_TIMEOUT = 300
+
 type Send struct {
 	Error string `json:"error"`
+	Hash  string `json:"hash"`
+}
+
+// SendRequest is the send request with request_id which is stored in Requests bucket. Hash is empty
+// while the request is being processed.
+type SendRequest struct {
+	Sender    int64  `json:"sender"`
+	Recipient int64  `json:"recipient"`
+	Amount    string `json:"amount"`
+	Hash      string `json:"hash"`
+	Time      int64  `json:"time"`
+}
+
+// requestKey returns the key of request_id in Requests bucket. The identifiers of the different tokens
+// don't intersect.
+func requestKey(id, requestId string) []byte {
+	return []byte(id + `:` + requestId)
+}
+
+// reserveRequest saves request_id before the sending. It returns the hash of the transaction if the request
+// has been already sent.
+func reserveRequest(key []byte, req *SendRequest) (string, error) {
+	var hash string
+	err := boltDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(requests)
+		if err != nil {
+			return err
+		}
+		if data := b.Get(key); len(data) > 0 {
+			var prev SendRequest
+			if err = json.Unmarshal(data, &prev); err != nil {
+				return err
+			}
+			if prev.Sender != req.Sender || prev.Recipient != req.Recipient || prev.Amount != req.Amount {
+				return fmt.Errorf(`request_id has been used with other parameters`)
+			}
+			if len(prev.Hash) > 0 {
+				hash = prev.Hash
+				return nil
+			}
+			if req.Time-prev.Time < REQUEST_TIMEOUT {
+				return fmt.Errorf(`request_id is being processed`)
+			}
+		}
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, data)
+	})
+	return hash, err
 }
 
-func send(r *http.Request) interface{} {
+// finishRequest saves the hash of the sent transaction or removes request_id if the sending has failed
+func finishRequest(key []byte, req *SendRequest) error {
+	return boltDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(requests)
+		if len(req.Hash) == 0 {
+			return b.Delete(key)
+		}
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, data)
+	})
+}
+
+func send(r *http.Request, id string) interface{} {
 	var (
 		result Send
 		priv   []byte
@@ -60,6 +131,25 @@ func send(r *http.Request) interface{} {
 		result.Error = err.Error()
 		return result
 	}
+	if requestId := r.FormValue(`request_id`); len(requestId) > 0 {
+		key := requestKey(id, requestId)
+		req := SendRequest{Sender: sender, Recipient: recipient, Amount: amount.String(), Time: time.Now().Unix()}
+		hash, err := reserveRequest(key, &req)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if len(hash) > 0 {
+			result.Hash = hash
+			return result
+		}
+		defer func() {
+			req.Hash = result.Hash
+			if err := finishRequest(key, &req); err != nil {
+				log.Error(`exchangeapi request_id`, err)
+			}
+		}()
+	}
 
 	err = boltDB.View(func(tx *bolt.Tx) error {
 		var err error
@@ -139,5 +229,6 @@ func send(r *http.Request) interface{} {
 		result.Error = err.Error()
 		return result
 	}
+	result.Hash = string(utils.Md5(data))
 	return result
 }
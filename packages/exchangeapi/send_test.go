@@ -0,0 +1,96 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package exchangeapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// openTestDB replaces boltDB with the temporary database
+func openTestDB(t *testing.T) func() {
+	dir, err := ioutil.TempDir(``, `exchangeapi`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if boltDB, err = bolt.Open(filepath.Join(dir, `exchangeapi.db`), 0600, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	boltDB.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(settings)
+		return err
+	})
+	return func() {
+		boltDB.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSendRequest(t *testing.T) {
+	defer openTestDB(t)()
+
+	key := requestKey(`token1`, `order-1`)
+	req := SendRequest{Sender: 1, Recipient: 2, Amount: `100`, Time: 1000}
+	if hash, err := reserveRequest(key, &req); err != nil || len(hash) > 0 {
+		t.Fatalf(`reserve %s %v`, hash, err)
+	}
+	retry := req
+	retry.Time += 10
+	if _, err := reserveRequest(key, &retry); err == nil {
+		t.Errorf(`request_id has been reserved twice`)
+	}
+	other := req
+	other.Amount = `200`
+	if _, err := reserveRequest(key, &other); err == nil {
+		t.Errorf(`request_id has been used with other parameters`)
+	}
+	// the same request_id of the other token is the other request
+	if _, err := reserveRequest(requestKey(`token2`, `order-1`), &other); err != nil {
+		t.Error(err)
+	}
+
+	req.Hash = `0123456789abcdef0123456789abcdef`
+	if err := finishRequest(key, &req); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := reserveRequest(key, &retry); err != nil || hash != req.Hash {
+		t.Errorf(`wrong hash of the sent request %s %v`, hash, err)
+	}
+
+	// the reservation without the hash expires after REQUEST_TIMEOUT
+	req.Hash = ``
+	key = requestKey(`token1`, `order-2`)
+	if _, err := reserveRequest(key, &req); err != nil {
+		t.Fatal(err)
+	}
+	retry.Time = req.Time + REQUEST_TIMEOUT
+	if hash, err := reserveRequest(key, &retry); err != nil || len(hash) > 0 {
+		t.Errorf(`the stale request has not been expired %s %v`, hash, err)
+	}
+	retry.Hash = ``
+	if err := finishRequest(key, &retry); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := reserveRequest(key, &req); err != nil || len(hash) > 0 {
+		t.Errorf(`the failed request has not been removed %s %v`, hash, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package exchangeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+	"github.com/boltdb/bolt"
+)
+
+// Status is the state of the transaction. Status can be queued, in_block or rejected.
+// Reason is the error of the rejected transaction.
+type Status struct {
+	Error         string `json:"error"`
+	Hash          string `json:"hash"`
+	Status        string `json:"status"`
+	BlockId       int64  `json:"block_id"`
+	Confirmations int64  `json:"confirmations"`
+	Reason        string `json:"reason"`
+}
+
+func status(r *http.Request, id string) interface{} {
+	var result Status
+
+	hash := r.FormValue(`hash`)
+	if requestId := r.FormValue(`request_id`); len(hash) == 0 && len(requestId) > 0 {
+		err := boltDB.View(func(tx *bolt.Tx) error {
+			var req SendRequest
+			b := tx.Bucket(requests)
+			if b == nil {
+				return nil
+			}
+			if data := b.Get(requestKey(id, requestId)); len(data) > 0 {
+				if err := json.Unmarshal(data, &req); err != nil {
+					return err
+				}
+				hash = req.Hash
+			}
+			return nil
+		})
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if len(hash) == 0 {
+			result.Error = `Request has not been found`
+			return result
+		}
+	}
+	if !regexp.MustCompile(`^[0-9a-fA-F]{32}$`).MatchString(hash) {
+		result.Error = `Hash is invalid`
+		return result
+	}
+	tx, err := utils.DB.OneRow(`SELECT block_id, error FROM transactions_status WHERE hash = [hex]`, hash).String()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(tx) == 0 {
+		result.Error = `Transaction has not been found`
+		return result
+	}
+	result.Hash = hash
+	if blockId := utils.StrToInt64(tx[`block_id`]); blockId > 0 {
+		result.Status = `in_block`
+		result.BlockId = blockId
+		current, err := utils.DB.GetBlockId()
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if current >= blockId {
+			result.Confirmations = current - blockId + 1
+		}
+	} else if len(tx[`error`]) > 0 {
+		result.Status = `rejected`
+		result.Reason = tx[`error`]
+	} else {
+		result.Status = `queued`
+	}
+	return result
+}
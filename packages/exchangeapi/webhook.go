@@ -0,0 +1,290 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package exchangeapi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/lib"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// WEBHOOK_PERIOD is the pause in seconds between the checks of the new transfers
+	WEBHOOK_PERIOD = 5
+	// WEBHOOK_BATCH is the maximum count of the transfers which are checked at once
+	WEBHOOK_BATCH = 100
+	// WEBHOOK_ATTEMPTS is the count of the attempts after which the notification is marked as failed
+	WEBHOOK_ATTEMPTS = 20
+	// WEBHOOK_BACKOFF is the pause in seconds after the first failed attempt. It is doubled after each attempt.
+	WEBHOOK_BACKOFF = 10
+	// WEBHOOK_MAX_BACKOFF is the maximum pause in seconds between the attempts
+	WEBHOOK_MAX_BACKOFF = 3600
+	// WEBHOOK_TIMEOUT is the timeout in seconds of the webhook request
+	WEBHOOK_TIMEOUT = 10
+)
+
+var (
+	// webhooks is the delivery log. The key is the identifier of the transfer in dlt_transactions.
+	webhooks = []byte(`Webhooks`)
+	// webhookQueue contains the keys of the notifications which have not been delivered yet
+	webhookQueue  = []byte(`WebhookQueue`)
+	webhookCursor = []byte(`WebhookCursor`)
+)
+
+// Notification is the body of the webhook request about the incoming transfer
+type Notification struct {
+	HistOper
+	Wallet        string `json:"wallet"`
+	WalletId      int64  `json:"wallet_id"`
+	Confirmations int64  `json:"confirmations"`
+}
+
+// Delivery is the record of the delivery log. Status can be pending, delivered or failed.
+type Delivery struct {
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	Next      int64           `json:"next"`
+	Error     string          `json:"error"`
+	Created   int64           `json:"created"`
+	Delivered int64           `json:"delivered"`
+}
+
+// Webhooks watches the committed transfers to the wallets of exchangeapi and sends the notifications
+// to -webhookUrl. The notifications are signed with -webhookSecret, so it is required with -webhookUrl.
+// It must be started as a goroutine.
+func Webhooks() {
+	if len(*utils.WebhookUrl) > 0 && len(*utils.WebhookSecret) == 0 {
+		log.Error(`-webhookSecret parameter must be specified with -webhookUrl`)
+		return
+	}
+	for {
+		if len(*utils.WebhookUrl) > 0 && utils.DB != nil {
+			if err := scanTransfers(); err != nil {
+				log.Error(`exchangeapi webhook`, err)
+			}
+			deliverWebhooks()
+		}
+		time.Sleep(WEBHOOK_PERIOD * time.Second)
+	}
+}
+
+func webhookKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// managedWallets returns the wallets which keys are stored in Keys bucket
+func managedWallets() (map[int64]bool, error) {
+	wallets := make(map[int64]bool)
+	err := boltDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			wallets[utils.StrToInt64(string(k))] = true
+			return nil
+		})
+	})
+	return wallets, err
+}
+
+// scanTransfers adds the notifications about the transfers which have got -webhookConfirm confirmations.
+// The identifier of the last checked transfer is stored in Settings bucket. On the first run the cursor
+// is set to the last transfer, so the notifications are not sent about the old transfers.
+func scanTransfers() error {
+	var cursor []byte
+	boltDB.View(func(tx *bolt.Tx) error {
+		cursor = tx.Bucket(settings).Get(webhookCursor)
+		return nil
+	})
+	if cursor == nil {
+		last, err := utils.DB.Single(`SELECT max(id) FROM dlt_transactions`).Int64()
+		if err != nil {
+			return err
+		}
+		return boltDB.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(settings).Put(webhookCursor, []byte(utils.Int64ToStr(last)))
+		})
+	}
+	current, err := utils.DB.GetBlockId()
+	if err != nil {
+		return err
+	}
+	confirm := *utils.WebhookConfirm
+	if confirm < 1 {
+		confirm = 1
+	}
+	list, err := utils.DB.GetAll(fmt.Sprintf(`SELECT %s FROM dlt_transactions WHERE id > ? AND block_id <= ?
+		ORDER BY id LIMIT %d`, histColumns, WEBHOOK_BATCH), -1, utils.StrToInt64(string(cursor)), current-confirm+1)
+	if err != nil || len(list) == 0 {
+		return err
+	}
+	return queueTransfers(list, current)
+}
+
+// queueTransfers adds the notifications about the transfers to the managed wallets and moves the cursor
+// to the last transfer of the list
+func queueTransfers(list []map[string]string, current int64) error {
+	wallets, err := managedWallets()
+	if err != nil {
+		return err
+	}
+	return boltDB.Update(func(tx *bolt.Tx) error {
+		deliveries, err := tx.CreateBucketIfNotExists(webhooks)
+		if err != nil {
+			return err
+		}
+		queue, err := tx.CreateBucketIfNotExists(webhookQueue)
+		if err != nil {
+			return err
+		}
+		for _, item := range list {
+			wallet := utils.StrToInt64(item[`recipient_wallet_id`])
+			if !wallets[wallet] {
+				continue
+			}
+			note := Notification{HistOper: histOper(item, wallet), Wallet: lib.AddressToString(uint64(wallet)),
+				WalletId: wallet}
+			note.Confirmations = current - note.BlockId + 1
+			key := webhookKey(note.Id)
+			if deliveries.Get(key) != nil {
+				continue
+			}
+			payload, err := json.Marshal(note)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(Delivery{Payload: payload, Status: `pending`, Created: time.Now().Unix()})
+			if err != nil {
+				return err
+			}
+			if err = deliveries.Put(key, data); err != nil {
+				return err
+			}
+			if err = queue.Put(key, []byte{}); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(settings).Put(webhookCursor, []byte(list[len(list)-1][`id`]))
+	})
+}
+
+// deliverWebhooks sends the queued notifications. The failed notification is retried with the exponential backoff.
+func deliverWebhooks() {
+	keys := make([][]byte, 0)
+	boltDB.View(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(webhookQueue)
+		if queue == nil {
+			return nil
+		}
+		return queue.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			return nil
+		})
+	})
+	for _, key := range keys {
+		var item Delivery
+		err := boltDB.View(func(tx *bolt.Tx) error {
+			return json.Unmarshal(tx.Bucket(webhooks).Get(key), &item)
+		})
+		if err != nil {
+			log.Error(`exchangeapi webhook`, err)
+			continue
+		}
+		now := time.Now().Unix()
+		if item.Next > now {
+			continue
+		}
+		item.Attempts++
+		if err = postWebhook(key, item.Payload); err == nil {
+			item.Status = `delivered`
+			item.Delivered = now
+			item.Error = ``
+		} else {
+			item.Error = err.Error()
+			if item.Attempts >= WEBHOOK_ATTEMPTS {
+				item.Status = `failed`
+			} else {
+				pause := int64(WEBHOOK_MAX_BACKOFF)
+				if item.Attempts < 16 {
+					pause = WEBHOOK_BACKOFF << uint(item.Attempts-1)
+				}
+				if pause > WEBHOOK_MAX_BACKOFF {
+					pause = WEBHOOK_MAX_BACKOFF
+				}
+				item.Next = now + pause
+			}
+		}
+		err = boltDB.Update(func(tx *bolt.Tx) error {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if err = tx.Bucket(webhooks).Put(key, data); err != nil {
+				return err
+			}
+			if item.Status != `pending` {
+				return tx.Bucket(webhookQueue).Delete(key)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error(`exchangeapi webhook`, err)
+		}
+	}
+}
+
+// webhookSign returns HMAC-SHA256 signature of the payload with the key secret
+func webhookSign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook sends the notification. Any response except 2xx is considered as the failure.
+func postWebhook(key []byte, payload []byte) error {
+	req, err := http.NewRequest(`POST`, *utils.WebhookUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(`Content-Type`, `application/json; charset=utf-8`)
+	req.Header.Set(`X-Webhook-Id`, utils.Int64ToStr(int64(binary.BigEndian.Uint64(key))))
+	req.Header.Set(`X-Signature`, webhookSign(*utils.WebhookSecret, payload))
+	client := http.Client{Timeout: WEBHOOK_TIMEOUT * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf(`webhook response %s`, resp.Status)
+	}
+	return nil
+}
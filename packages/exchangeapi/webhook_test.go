@@ -0,0 +1,102 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package exchangeapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+	"github.com/boltdb/bolt"
+)
+
+func TestWebhookSign(t *testing.T) {
+	payload := []byte(`{"id":15}`)
+	// HMAC-SHA256 of the payload with the key secret
+	if sign := webhookSign(`secret`, payload); sign != `319a5026d485f4730d160bbf37594957acec10f7590f3fe8aff7a3238b28f2fd` {
+		t.Errorf(`wrong signature %s`, sign)
+	}
+	if webhookSign(`other`, payload) == webhookSign(`secret`, payload) {
+		t.Errorf(`the signature doesn't depend on the key`)
+	}
+}
+
+func TestQueueTransfers(t *testing.T) {
+	defer openTestDB(t)()
+
+	boltDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(`200`), []byte(`key`))
+	})
+	list := []map[string]string{
+		{`id`: `7`, `block_id`: `10`, `sender_wallet_id`: `100`, `recipient_wallet_id`: `200`, `amount`: `5`},
+		{`id`: `8`, `block_id`: `11`, `sender_wallet_id`: `200`, `recipient_wallet_id`: `300`, `amount`: `6`},
+	}
+	if err := queueTransfers(list, 12); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		cursor string
+		queued int
+		item   Delivery
+		note   Notification
+	)
+	boltDB.View(func(tx *bolt.Tx) error {
+		cursor = string(tx.Bucket(settings).Get(webhookCursor))
+		queued = tx.Bucket(webhookQueue).Stats().KeyN
+		return json.Unmarshal(tx.Bucket(webhooks).Get(webhookKey(7)), &item)
+	})
+	if cursor != `8` || queued != 1 || item.Status != `pending` {
+		t.Fatalf(`wrong queue %s %d %v`, cursor, queued, item)
+	}
+	if err := json.Unmarshal(item.Payload, &note); err != nil {
+		t.Fatal(err)
+	}
+	if note.WalletId != 200 || note.Direction != `in` || note.Confirmations != 3 {
+		t.Errorf(`wrong notification %v`, note)
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	payload := []byte(`{"id":7}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(`X-Webhook-Id`) != `7` || r.Header.Get(`X-Signature`) != webhookSign(`secret`, body) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	url, secret := *utils.WebhookUrl, *utils.WebhookSecret
+	defer func() {
+		*utils.WebhookUrl, *utils.WebhookSecret = url, secret
+	}()
+	*utils.WebhookUrl, *utils.WebhookSecret = server.URL, `secret`
+	if err := postWebhook(webhookKey(7), payload); err != nil {
+		t.Error(err)
+	}
+	*utils.WebhookSecret = `other`
+	if err := postWebhook(webhookKey(7), payload); err == nil {
+		t.Errorf(`the request with the wrong signature has been accepted`)
+	}
+}
@@ -105,6 +105,10 @@ func (p *Parser) ActivateContract() error {
 		return err
 	}
 	smart.ActivateContract(utils.StrToInt64(p.TxMaps.String["id"]), prefix, true)
+	// the cache is compiled again at the next start, so the error doesn't fail the transaction
+	if err := utils.InvalidateContract(prefix, utils.StrToInt64(p.TxMaps.String["id"])); err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+	}
 	return nil
 }
 
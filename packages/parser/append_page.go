@@ -85,6 +85,7 @@ func (p *Parser) AppendPage() error {
 	if err != nil {
 		return p.ErrInfo(err)
 	}
+	utils.InvalidatePage(prefix+"_pages", p.TxMaps.String["name"])
 
 	return nil
 }
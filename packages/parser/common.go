@@ -28,6 +28,7 @@ import (
 	//	"github.com/EGaaS/go-egaas-mvp/packages/lib"
 	"github.com/EGaaS/go-egaas-mvp/packages/script"
 	"github.com/EGaaS/go-egaas-mvp/packages/smart"
+	"github.com/EGaaS/go-egaas-mvp/packages/textproc"
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
 	"github.com/op/go-logging"
 	"github.com/shopspring/decimal"
@@ -442,23 +443,21 @@ func (p *Parser) AccessRights(condition string, iscondition bool) error {
 func (p *Parser) AccessTable(table, action string) error {
 
 	//	prefix := utils.Int64ToStr(int64(p.TxStateID))
-	govAccount, _ := utils.StateParam(int64(p.TxStateID), `gov_account`)
+	govAccount, _ := storage.StateParam(int64(p.TxStateID), `gov_account`)
 	if table == `dlt_wallets` && p.TxContract != nil && p.TxCitizenID == utils.StrToInt64(govAccount) {
 		return nil
 	}
 
-	if isCustom, err := p.IsCustomTable(table); err != nil {
+	if isCustom, err := storage.IsCustomTable(table); err != nil {
 		return err // table != ... временно оставлено для совместимости. После переделки new_state убрать
 	} else if !isCustom && !strings.HasSuffix(table, `_citizenship_requests`) {
 		return fmt.Errorf(table + ` is not a custom table`)
 	}
-	prefix := table[:strings.IndexByte(table, '_')]
-
 	/*	if p.TxStateID == 0 {
 		return nil
 	}*/
 
-	tablePermission, err := p.GetMap(`SELECT data.* FROM "`+prefix+`_tables", jsonb_each_text(columns_and_permissions) as data WHERE name = ?`, "key", "value", table)
+	tablePermission, err := storage.Permissions(table, ``)
 	if err != nil {
 		return err
 	}
@@ -478,18 +477,16 @@ func (p *Parser) AccessColumns(table string, columns []string) error {
 
 	//prefix := utils.Int64ToStr(int64(p.TxStateID))
 
-	if isCustom, err := p.IsCustomTable(table); err != nil {
+	if isCustom, err := storage.IsCustomTable(table); err != nil {
 		return err // table != ... временно оставлено для совместимости. После переделки new_state убрать
 	} else if !isCustom && !strings.HasSuffix(table, `_citizenship_requests`) {
 		return fmt.Errorf(table + ` is not a custom table`)
 	}
-	prefix := table[:strings.IndexByte(table, '_')]
 	/*	if p.TxStateID == 0 {
 		return nil
 	}*/
 
-	columnsAndPermissions, err := p.GetMap(`SELECT data.* FROM "`+prefix+`_tables", jsonb_each_text(columns_and_permissions->'update') as data WHERE name = ?`,
-		"key", "value", table)
+	columnsAndPermissions, err := storage.Permissions(table, `update`)
 	if err != nil {
 		return err
 	}
@@ -535,6 +532,19 @@ func (p *Parser) AccessChange(table, name string) error {
 	return nil
 }
 
+// checkPage validates the source of the page template
+func checkPage(value string) error {
+	errs := textproc.Validate(value)
+	if len(errs) == 0 {
+		return nil
+	}
+	list := make([]string, len(errs))
+	for i, item := range errs {
+		list[i] = item.Error()
+	}
+	return fmt.Errorf(`wrong page template: %s`, strings.Join(list, `; `))
+}
+
 func (p *Parser) getEGSPrice(name string) (decimal.Decimal, error) {
 	fPrice, err := p.Single(`SELECT value->'`+name+`' FROM system_parameters WHERE name = ?`, "op_price").String()
 	if err != nil {
@@ -578,53 +588,42 @@ func (p *Parser) GetContractLimit() (ret int64) {
 	return p.TxCost
 }
 
-/*func (p *Parser) CheckContractLimit(price int64) bool {
-	return true
-	var balance decimal.Decimal
-	fuel := p.GetFuel()
-	if fuel <= 0 {
-		return false
-	}
-	need := p.TxCost * fuel // need qEGS = F*fuel
-	//	wallet := p.TxWalletID
-	if p.TxStateID > 0 && p.TxCitizenID != 0 {
-		var needuser int64
-		rate, _ := utils.EGSRate(int64(p.TxStateID)) // money/egs
-		tableAccounts, _ := utils.StateParam(int64(p.TxStateID), `table_accounts`)
-		tableAccounts = lib.Escape(tableAccounts)
-		if len(tableAccounts) == 0 {
-			tableAccounts = `accounts`
-		}
-		if rate == 0 {
-			rate = 1.0
-		}
-		p.TxContract.EGSRate = rate
-		p.TxContract.TableAccounts = tableAccounts
+// contractPayer returns the wallet which pays for the contract. The government pays for its citizens.
+func (p *Parser) contractPayer() int64 {
+	if p.TxStateID > 0 && p.TxCitizenID != 0 && p.TxContract != nil {
+		return utils.StrToInt64(StateVal(p, `gov_account`))
+	}
+	return p.TxWalletID
+}
 
-		if price >= 0 {
-			needuser = int64(float64(price) * rate)
-		} else {
-			needuser = int64(float64(need) * rate)
-		}
-		p.TxContract.TxGovAccount = utils.StrToInt64(StateVal(p, `gov_account`))
-		if needuser > 0 {
-			if money, _ := p.Single(fmt.Sprintf(`select amount from "%d_%s" where citizen_id=?`, p.TxStateID, tableAccounts),
-				p.TxCitizenID).Int64(); money < needuser {
-				return false
-			}
-		}
-		// Check if government has enough money
-		balance, _ = utils.Balance(p.TxContract.TxGovAccount)
-		//wallet = p.TxCitizenID
-	} else {
-		//if balance.Cmp(decimal.New(0, 0)) == 0 {
-		balance, _ = utils.Balance(p.TxWalletID)
+// contractPrice returns max(price, cost*fuel) which must be paid for the contract
+func contractPrice(price int64, cost, fuel decimal.Decimal) decimal.Decimal {
+	need := cost.Mul(fuel)
+	if dprice := decimal.New(price, 0); dprice.Cmp(need) > 0 {
+		need = dprice
+	}
+	return need
+}
+
+// CheckContractLimit checks that the payer has enough money to pay the price of the contract
+// and the cost of the resources which have been spent by the contract
+func (p *Parser) CheckContractLimit(price, cost int64) error {
+	fuel := storage.Fuel()
+	if fuel.Cmp(decimal.New(0, 0)) <= 0 {
+		return fmt.Errorf(`fuel rate must be greater than 0`)
+	}
+	need := contractPrice(price, decimal.New(cost, 0), fuel)
+	wallet := p.contractPayer()
+	balance, err := storage.Balance(wallet)
+	if err != nil {
+		return err
 	}
-	/*		TxCitizenID      int64
-			TxWalletID       int64
-			TxStateID
-	return balance.Cmp(decimal.New(need, 0)) > 0
-}*/
+	if balance.Cmp(need) < 0 {
+		return fmt.Errorf(`not enough money on the wallet %d to pay for the contract %s (%s instead of %s)`,
+			wallet, p.TxContract.Name, balance, need)
+	}
+	return nil
+}
 
 func (p *Parser) payFPrice() error {
 	var (
@@ -644,15 +643,12 @@ func (p *Parser) payFPrice() error {
 			fromId = p.TxCitizenID
 		}
 	} else { // contract
-		if p.TxStateID > 0 && p.TxCitizenID != 0 && p.TxContract != nil {
-			//fromId = p.TxContract.TxGovAccount
-			fromId = utils.StrToInt64(StateVal(p, `gov_account`))
-		} else {
-			// списываем напрямую с dlt_wallets у юзера
-			fromId = p.TxWalletID
-		}
+		fromId = p.contractPayer()
 	}
 	egs := p.TxUsedCost.Mul(fuel)
+	if p.TxContract != nil {
+		egs = contractPrice(p.TxContract.TxPrice, p.TxUsedCost, fuel)
+	}
 	fmt.Printf("Pay fuel=%v fromId=%d toId=%d cost=%v egs=%v", fuel, fromId, toId, p.TxUsedCost, egs)
 	if egs.Cmp(decimal.New(0, 0)) == 0 { // Is it possible to pay nothing?
 		return nil
@@ -665,6 +661,8 @@ func (p *Parser) payFPrice() error {
 	if err != nil {
 		return err
 	}
+	// CheckContractLimit has checked the balance before action, but action can spend the money of the payer.
+	// The transaction is already applied here, so the payer pays as much as it has.
 	if damount.Cmp(egs) < 0 {
 		egs = damount
 	}
@@ -17,6 +17,8 @@
 package parser
 
 import (
+	"strings"
+
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
 )
 
@@ -43,6 +45,17 @@ func (p *Parser) autoRollback() error {
 		if err != nil {
 			return p.ErrInfo(err)
 		}
+		if strings.HasSuffix(rollbackTxRow.table_name, `_pages`) {
+			utils.InvalidatePage(rollbackTxRow.table_name, rollbackTxRow.table_id)
+		}
+		if strings.HasSuffix(rollbackTxRow.table_name, `_smart_contracts`) {
+			// the previous version of the contract must be restored in VM
+			err = utils.ReloadContract(strings.TrimSuffix(rollbackTxRow.table_name, `_smart_contracts`),
+				utils.StrToInt64(rollbackTxRow.table_id))
+			if err != nil {
+				return p.ErrInfo(err)
+			}
+		}
 	}
 	err = p.ExecSql("DELETE FROM rollback_tx WHERE tx_hash = [hex]", p.TxHash)
 	if err != nil {
@@ -27,7 +27,7 @@ import (
 func (p *Parser) CheckBlockHeader() error {
 	var err error
 	// инфа о предыдущем блоке (т.е. последнем занесенном).
-	// в GetBlocks p.PrevBlock определяется снаружи, поэтому тут важно не перезаписать данными из block_chain
+	// при генерации блока p.PrevBlock определяется снаружи через GetInfoBlock, поэтому тут важно не перезаписать данными из block_chain
 	if p.PrevBlock == nil || p.PrevBlock.BlockId != p.BlockData.BlockId-1 {
 		p.PrevBlock, err = p.GetBlockDataFromBlockChain(p.BlockData.BlockId - 1)
 		log.Debug("PrevBlock 0", p.PrevBlock)
@@ -175,8 +175,8 @@ func (p *Parser) DLTTransfer() error {
 	}
 
 	// пишем в общую историю тр-ий
-	dlt_transactions_id, err := p.ExecSqlGetLastInsertId(`INSERT INTO dlt_transactions ( sender_wallet_id, recipient_wallet_id, recipient_wallet_address, amount, commission, comment, time, block_id ) VALUES ( ?, ?, ?, ?, ?, ?, ?, ? )`, "dlt_transactions",
-		p.TxWalletID, walletId, lib.AddressToString(utils.StrToUint64(p.TxMaps.String["walletAddress"])), p.TxMaps.Decimal["amount"].String(), p.TxMaps.Decimal["commission"].String(), p.TxMaps.Bytes["comment"], p.BlockData.Time, p.BlockData.BlockId)
+	dlt_transactions_id, err := p.ExecSqlGetLastInsertId(`INSERT INTO dlt_transactions ( sender_wallet_id, recipient_wallet_id, recipient_wallet_address, amount, commission, comment, time, block_id, tx_hash ) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, [hex] )`, "dlt_transactions",
+		p.TxWalletID, walletId, lib.AddressToString(utils.StrToUint64(p.TxMaps.String["walletAddress"])), p.TxMaps.Decimal["amount"].String(), p.TxMaps.Decimal["commission"].String(), p.TxMaps.Bytes["comment"], p.BlockData.Time, p.BlockData.BlockId, p.TxHash)
 	if err != nil {
 		return p.ErrInfo(err)
 	}
@@ -185,7 +185,7 @@ func (p *Parser) DLTTransfer() error {
 		return err
 	}
 
-	dlt_transactions_id, err = p.ExecSqlGetLastInsertId(`INSERT INTO dlt_transactions ( sender_wallet_id, recipient_wallet_id, recipient_wallet_address, amount, commission, comment, time, block_id ) VALUES ( ?, ?, ?, ?, ?, ?, ?, ? )`, "dlt_transactions", p.TxWalletID, p.BlockData.WalletId, lib.AddressToString(uint64(p.BlockData.WalletId)), p.TxMaps.Decimal["commission"].String(), 0, "Commission", p.BlockData.Time, p.BlockData.BlockId)
+	dlt_transactions_id, err = p.ExecSqlGetLastInsertId(`INSERT INTO dlt_transactions ( sender_wallet_id, recipient_wallet_id, recipient_wallet_address, amount, commission, comment, time, block_id, tx_hash ) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, [hex] )`, "dlt_transactions", p.TxWalletID, p.BlockData.WalletId, lib.AddressToString(uint64(p.BlockData.WalletId)), p.TxMaps.Decimal["commission"].String(), 0, "Commission", p.BlockData.Time, p.BlockData.BlockId, p.TxHash)
 	if err != nil {
 		return p.ErrInfo(err)
 	}
@@ -69,6 +69,12 @@ func (p *Parser) EditContractFront() error {
 			return p.ErrInfo(err)
 		}
 	}
+	// the checks of the source code are applied only to the new transactions, the blocks are checked as before
+	if p.BlockData == nil {
+		if err := smart.CheckContract(p.TxMaps.String["value"], prefix); err != nil {
+			return p.ErrInfo(err)
+		}
+	}
 	conditions, err := p.Single(`SELECT conditions FROM "`+prefix+`_smart_contracts" WHERE id = ?`, p.TxMaps.String["id"]).String()
 	if err != nil {
 		return p.ErrInfo(err)
@@ -115,6 +121,7 @@ func (p *Parser) EditContract() error {
 			root.Children[i].Info.(*script.ContractInfo).Active = active
 		}
 	}
+	utils.CacheContract(prefix, tblid, p.TxMaps.String["value"], root)
 	smart.FlushBlock(root)
 	return nil
 }
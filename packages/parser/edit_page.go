@@ -66,6 +66,12 @@ func (p *Parser) EditPageFront() error {
 			return p.ErrInfo(err)
 		}
 	}
+	// the template is validated only in the new transactions, the blocks are checked as before
+	if p.BlockData == nil {
+		if err = checkPage(string(p.TxMap["value"])); err != nil {
+			return p.ErrInfo(err)
+		}
+	}
 	if err = p.AccessChange(`pages`, p.TxMaps.String["name"]); err != nil {
 		if p.AccessRights(`changing_page`, false) != nil {
 			return err
@@ -85,6 +91,7 @@ func (p *Parser) EditPage() error {
 	if err != nil {
 		return p.ErrInfo(err)
 	}
+	utils.InvalidatePage(prefix+"_pages", p.TxMaps.String["name"])
 
 	return nil
 }
@@ -0,0 +1,340 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+)
+
+// ChainTip is the last block of the chain. The tips of the other nodes are received by Type1 and
+// are kept in queue_blocks.
+type ChainTip struct {
+	BlockId    int64
+	Hash       []byte
+	FullNodeId int64
+}
+
+// ChooseTip returns true and the reason if the chain with the tip theirs must replace the chain with
+// the tip ours. The longer chain wins. If the chains have the same length, the tip with the lower hash wins,
+// so all nodes choose the same chain.
+func ChooseTip(ours, theirs *ChainTip) (bool, string) {
+	switch {
+	case theirs.BlockId > ours.BlockId:
+		return true, fmt.Sprintf(`longer chain %d > %d`, theirs.BlockId, ours.BlockId)
+	case theirs.BlockId == ours.BlockId && bytes.Compare(theirs.Hash, ours.Hash) < 0:
+		return true, fmt.Sprintf(`same length %d, lower hash %x < %x`, theirs.BlockId, theirs.Hash, ours.Hash)
+	}
+	return false, ``
+}
+
+// ourTip returns the last block of our chain
+func (p *Parser) ourTip() (*ChainTip, error) {
+	info, err := p.OneRow(`SELECT block_id, hash FROM info_block`).String()
+	if err != nil {
+		return nil, utils.ErrInfo(err)
+	}
+	return &ChainTip{BlockId: utils.StrToInt64(info[`block_id`]), Hash: []byte(info[`hash`])}, nil
+}
+
+// BestTip returns the tip from queue_blocks which wins over our chain and the reason of the choice.
+// The tips which lose are removed from queue_blocks. It returns nil if there is no better tip.
+func (p *Parser) BestTip() (*ChainTip, string, error) {
+	ours, err := p.ourTip()
+	if err != nil {
+		return nil, ``, err
+	}
+	list, err := p.GetAll(`SELECT hash, full_node_id, block_id FROM queue_blocks`, -1)
+	if err != nil {
+		return nil, ``, utils.ErrInfo(err)
+	}
+	var (
+		best   *ChainTip
+		reason string
+	)
+	for _, item := range list {
+		tip := &ChainTip{BlockId: utils.StrToInt64(item[`block_id`]), Hash: []byte(item[`hash`]),
+			FullNodeId: utils.StrToInt64(item[`full_node_id`])}
+		ok, why := ChooseTip(ours, tip)
+		if !ok {
+			p.DeleteQueueBlock(string(utils.BinToHex(tip.Hash)))
+			continue
+		}
+		if best == nil {
+			best, reason = tip, why
+		} else if better, _ := ChooseTip(best, tip); better {
+			best, reason = tip, why
+		}
+	}
+	return best, reason, nil
+}
+
+// FinalBlockId returns the last block which can't be rolled back by the fork choice. It returns 0 if there is no
+// such block, then Reorg is limited only by the rollback window.
+func (p *Parser) FinalBlockId() (int64, error) {
+	return p.Single(`SELECT max(block_id) FROM confirmations WHERE good >= ? AND good >= bad * 2`,
+		consts.FINAL_CONFIRMED_NODES).Int64()
+}
+
+// Reorg switches our chain to the chain of host which ends with the block blockId. The blocks are downloaded
+// from blockId back to the first block which is the same in both chains and are kept in the temporary files.
+// The fork can't be below FinalBlockId and deeper than rollback blocks. The signatures of the new blocks
+// are checked before our blocks after the fork are rolled back by RollbackToBlockId, then the new blocks
+// are applied. If the new blocks are invalid our blocks are applied again. Every reorganization is recorded
+// in reorg_log.
+func (p *Parser) Reorg(host string, blockId, rollback int64, reason string) error {
+	ours, err := p.ourTip()
+	if err != nil {
+		return err
+	}
+	final, err := p.FinalBlockId()
+	if err != nil {
+		return utils.ErrInfo(err)
+	}
+	badBlocks, err := p.badBlocks()
+	if err != nil {
+		return err
+	}
+	entry := reorgEntry{host: host, reason: reason, oldBlockId: ours.BlockId, oldHash: ours.Hash}
+
+	// качаем блоки с конца, пока не найдем блок, который совпадает с нашим
+	blocks := make(map[int64]string)
+	defer ClearTmp(blocks)
+	forkId := blockId
+	for ; ; forkId-- {
+		var reject error
+		if forkId <= final || forkId < 2 {
+			reject = fmt.Errorf(`the fork is below the final block %d`, final)
+		} else if forkId < ours.BlockId-rollback || blockId-forkId > rollback {
+			reject = fmt.Errorf(`the fork is deeper than %d blocks`, rollback)
+		}
+		if reject != nil {
+			entry.forkId, entry.depth = forkId, ours.BlockId-forkId
+			return p.logReorg(entry, `rejected`, reject)
+		}
+		data, err := utils.GetBlockBody(host, forkId, consts.DATA_TYPE_BLOCK_BODY)
+		if err != nil {
+			return utils.ErrInfo(err)
+		}
+		if len(data) < 2 || int64(len(data)) > consts.MAX_BLOCK_SIZE {
+			return utils.ErrInfo(fmt.Errorf(`invalid size of the block %d`, forkId))
+		}
+		header := data[1:]
+		blockData := utils.ParseBlockHeader(&header)
+		if blockData.BlockId != forkId {
+			return utils.ErrInfo(fmt.Errorf(`bad block_id %d != %d`, blockData.BlockId, forkId))
+		}
+		// если существует глючная цепочка, то тут мы её проигнорируем
+		if badBlocks[forkId] == string(utils.BinToHex(blockData.Sign)) {
+			entry.forkId, entry.depth = forkId, ours.BlockId-forkId
+			return p.logReorg(entry, `rejected`, fmt.Errorf(`bad block %d`, forkId))
+		}
+		if forkId <= ours.BlockId {
+			our, err := p.Single(`SELECT data FROM block_chain WHERE id = ?`, forkId).Bytes()
+			if err != nil {
+				return utils.ErrInfo(err)
+			}
+			if bytes.Equal(our, data) {
+				break
+			}
+		}
+		if err = tmpBlock(blocks, forkId, data); err != nil {
+			return err
+		}
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	entry.forkId, entry.depth = forkId, ours.BlockId-forkId
+
+	// до отката проверяем, что новые блоки подписаны и каждый ссылается на предыдущий
+	prev, err := p.GetBlockDataFromBlockChain(forkId)
+	if err != nil {
+		return utils.ErrInfo(err)
+	}
+	prevHash := prev.Hash
+	for id := forkId + 1; id <= blockId; id++ {
+		data, err := ioutil.ReadFile(blocks[id])
+		if err != nil {
+			return utils.ErrInfo(err)
+		}
+		if prevHash, err = p.checkBlockSign(data, prevHash); err != nil {
+			return p.logReorg(entry, `rejected`, err)
+		}
+	}
+
+	// сохраняем наши блоки, чтобы вернуть их, если новая цепочка окажется неверной
+	oldBlocks := make(map[int64]string)
+	defer ClearTmp(oldBlocks)
+	rows, err := p.Query(p.FormatQuery(`SELECT id, data FROM block_chain WHERE id > ? ORDER BY id`), forkId)
+	if err != nil {
+		return p.ErrInfo(err)
+	}
+	for rows.Next() {
+		var (
+			id   int64
+			data []byte
+		)
+		if err = rows.Scan(&id, &data); err == nil {
+			err = tmpBlock(oldBlocks, id, data)
+		}
+		if err != nil {
+			rows.Close()
+			return p.ErrInfo(err)
+		}
+	}
+	rows.Close()
+
+	log.Info("reorg from %s: fork %d depth %d new block %d: %s", host, forkId, entry.depth, blockId, reason)
+	// отмечаем, что наши тр-ии теперь нужно проверять по новой
+	if err = p.ExecSql("UPDATE transactions SET verified = 0 WHERE verified = 1 AND used = 0"); err != nil {
+		return p.logReorg(entry, `failed`, err)
+	}
+	if err = p.RollbackToBlockId(forkId); err != nil {
+		return p.logReorg(entry, `failed`, err)
+	}
+	if err = p.applyBlocks(blocks, forkId+1, blockId); err != nil {
+		log.Error("reorg from %s: %v", host, err)
+		if errBack := p.RollbackToBlockId(forkId); errBack == nil {
+			if errBack = p.applyBlocks(oldBlocks, forkId+1, ours.BlockId); errBack != nil {
+				log.Error("restore our chain: %v", errBack)
+			}
+		} else {
+			log.Error("restore our chain: %v", errBack)
+		}
+		return p.logReorg(entry, `failed`, err)
+	}
+	return p.logReorg(entry, `applied`, nil)
+}
+
+// badBlocks returns the signatures of the blocks from config.bad_blocks which must not be accepted
+func (p *Parser) badBlocks() (map[int64]string, error) {
+	badBlocks := make(map[int64]string)
+	data, err := p.Single(`SELECT bad_blocks FROM config`).Bytes()
+	if err != nil {
+		return nil, utils.ErrInfo(err)
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &badBlocks); err != nil {
+			return nil, utils.ErrInfo(err)
+		}
+	}
+	return badBlocks, nil
+}
+
+// checkBlockSign checks the signature of the downloaded block with the hash of the previous block and
+// returns the hash of the block. The hashes are in hex.
+func (p *Parser) checkBlockSign(data []byte, prevHash []byte) ([]byte, error) {
+	body := data[1:]
+	blockData := utils.ParseBlockHeader(&body)
+	mrklRoot, err := utils.GetMrklroot(body, false)
+	if err != nil {
+		return nil, utils.ErrInfo(err)
+	}
+	nodePublicKey, err := p.GetNodePublicKeyWalletOrCB(blockData.WalletId, blockData.CBID)
+	if err != nil {
+		return nil, utils.ErrInfo(err)
+	}
+	if len(nodePublicKey) == 0 {
+		return nil, fmt.Errorf(`empty node public key of the block %d`, blockData.BlockId)
+	}
+	forSign := fmt.Sprintf("0,%d,%s,%d,%d,%d,%s", blockData.BlockId, prevHash, blockData.Time, blockData.WalletId,
+		blockData.CBID, mrklRoot)
+	if ok, err := utils.CheckSign([][]byte{nodePublicKey}, forSign, blockData.Sign, true); !ok || err != nil {
+		return nil, fmt.Errorf(`incorrect signature of the block %d`, blockData.BlockId)
+	}
+	return utils.DSha256(fmt.Sprintf("%d,%s,%s,%d,%d,%d", blockData.BlockId, prevHash, mrklRoot, blockData.Time,
+		blockData.WalletId, blockData.CBID)), nil
+}
+
+// tmpBlock saves the block into the temporary file, so the blocks of the fork are not kept in memory
+func tmpBlock(files map[int64]string, blockId int64, data []byte) error {
+	file, err := ioutil.TempFile(*utils.Dir, "DC")
+	if err != nil {
+		return utils.ErrInfo(err)
+	}
+	files[blockId] = file.Name()
+	_, err = file.Write(data)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return utils.ErrInfo(err)
+	}
+	return nil
+}
+
+// applyBlocks checks and inserts the blocks [from, to] from the temporary files into block_chain one by one
+func (p *Parser) applyBlocks(files map[int64]string, from, to int64) error {
+	for id := from; id <= to; id++ {
+		data, err := ioutil.ReadFile(files[id])
+		if err != nil {
+			return utils.ErrInfo(err)
+		}
+		parser := new(Parser)
+		parser.DCDB = p.DCDB
+		parser.GoroutineName = p.GoroutineName
+		parser.BinaryData = data
+		err = parser.ParseDataFull(false)
+		if err == nil {
+			err = parser.InsertIntoBlockchain()
+		}
+		if err != nil {
+			parser.BlockError(err)
+			return utils.ErrInfo(err)
+		}
+	}
+	return nil
+}
+
+type reorgEntry struct {
+	host       string
+	reason     string
+	forkId     int64
+	depth      int64
+	oldBlockId int64
+	oldHash    []byte
+}
+
+// logReorg writes the result of the reorganization into reorg_log and returns reorgErr.
+// The new blocks after our last block are not the reorganization, so they are not logged.
+func (p *Parser) logReorg(entry reorgEntry, status string, reorgErr error) error {
+	if entry.depth == 0 && status != `rejected` {
+		return reorgErr
+	}
+	var errText string
+	if reorgErr != nil {
+		errText = reorgErr.Error()
+	}
+	ours, err := p.ourTip()
+	if err != nil {
+		ours = &ChainTip{}
+	}
+	err = p.ExecSql(`INSERT INTO reorg_log (time, host, fork_block_id, depth, old_block_id, old_hash, new_block_id,
+		new_hash, status, reason, error) VALUES (?, ?, ?, ?, ?, [hex], ?, [hex], ?, ?, ?)`, utils.Time(), entry.host,
+		entry.forkId, entry.depth, entry.oldBlockId, utils.BinToHex(entry.oldHash), ours.BlockId,
+		utils.BinToHex(ours.Hash), status, entry.reason, errText)
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+	}
+	return reorgErr
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package parser
+
+import (
+	"testing"
+)
+
+func TestChooseTip(t *testing.T) {
+	ours := &ChainTip{BlockId: 100, Hash: []byte{5, 5}}
+	for _, item := range []struct {
+		tip  ChainTip
+		want bool
+	}{
+		{ChainTip{BlockId: 101, Hash: []byte{9, 9}}, true},
+		{ChainTip{BlockId: 99, Hash: []byte{0, 0}}, false},
+		{ChainTip{BlockId: 100, Hash: []byte{5, 4}}, true},
+		{ChainTip{BlockId: 100, Hash: []byte{5, 5}}, false},
+		{ChainTip{BlockId: 100, Hash: []byte{5, 6}}, false},
+	} {
+		if got, reason := ChooseTip(ours, &item.tip); got != item.want {
+			t.Errorf(`wrong choice %v for %v %s`, got, item.tip, reason)
+		}
+	}
+}
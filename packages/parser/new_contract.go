@@ -81,6 +81,12 @@ func (p *Parser) NewContractFront() error {
 			return p.ErrInfo(err)
 		}
 	}
+	// the checks of the source code are applied only to the new transactions, the blocks are checked as before
+	if p.BlockData == nil {
+		if err := smart.CheckContract(p.TxMaps.String["value"], prefix); err != nil {
+			return p.ErrInfo(err)
+		}
+	}
 
 	if exist, err := p.Single(`select id from "`+prefix+"_smart_contracts"+`" where name=?`, p.TxMap["name"]).Int64(); err != nil {
 		return p.ErrInfo(err)
@@ -42,6 +42,12 @@ func (p *Parser) NewPageFront() error {
 	if strings.HasPrefix(string(p.TxMap["name"]), `sys-`) || strings.HasPrefix(string(p.TxMap["name"]), `app-`) {
 		return fmt.Errorf(`The name cannot start with sys- or app-`)
 	}
+	// the template is validated only in the new transactions, the blocks are checked as before
+	if p.BlockData == nil {
+		if err = checkPage(string(p.TxMap["value"])); err != nil {
+			return p.ErrInfo(err)
+		}
+	}
 
 	// Check InputData
 	/*verifyData := map[string]string{"name": "string", "value": "string", "menu": "string", "conditions": "string"}
@@ -78,6 +84,7 @@ func (p *Parser) NewPage() error {
 	if err != nil {
 		return p.ErrInfo(err)
 	}
+	utils.InvalidatePage(prefix+"_pages", p.TxMaps.String["name"])
 
 	return nil
 }
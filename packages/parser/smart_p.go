@@ -63,12 +63,12 @@ var (
 		"UpdateMenu":     200,
 		"UpdatePage":     200,
 		"DBInsertReport": 200,
+		"Emit":           100,
 	}
 )
 
 func init() {
 	smart.Extend(&script.ExtendData{map[string]interface{}{
-		//		"CallContract":   ExContract,
 		"DBInsert":           DBInsert,
 		"DBUpdate":           DBUpdate,
 		"DBUpdateExt":        DBUpdateExt,
@@ -105,11 +105,31 @@ func init() {
 		"UpdateMenu":      UpdateMenu,
 		"UpdatePage":      UpdatePage,
 		"DBInsertReport":  DBInsertReport,
+		"Emit":            Emit,
 		"check_signature": CheckSignature, // system function
 	}, map[string]string{
 		`*parser.Parser`: `parser`,
 	}})
 	smart.ExtendCost(getCost)
+	smart.ExtendTables(map[string]int{
+		"DBInsert":       script.TABLE_WRITE,
+		"DBInsertReport": script.TABLE_WRITE,
+		"DBUpdate":       script.TABLE_WRITE,
+		"DBUpdateExt":    script.TABLE_WRITE,
+		"DBTransfer":     script.TABLE_WRITE,
+		"DBGetList":      script.TABLE_READ,
+		"DBGetTable":     script.TABLE_READ,
+		"DBString":       script.TABLE_READ,
+		"DBInt":          script.TABLE_READ,
+		"DBStringExt":    script.TABLE_READ,
+		"DBIntExt":       script.TABLE_READ,
+		"DBFreeRequest":  script.TABLE_READ,
+		"DBStringWhere":  script.TABLE_READ,
+		"DBIntWhere":     script.TABLE_READ,
+		"DBAmount":       script.TABLE_READ,
+		"Table":          script.TABLE_PREFIX,
+		"TableTx":        script.TABLE_PREFIX | script.TABLE_ANY,
+	})
 	//	smart.Compile( embedContracts)
 }
 
@@ -204,7 +224,12 @@ func (p *Parser) CallContract(flags int) (err error) {
 			return fmt.Errorf("incorrect sign")
 		}
 	}
+	return p.RunContract(flags)
+}
 
+// RunContract executes the functions of p.TxContract which are specified by flags.
+// Unlike CallContract it doesn't check the signature of the transaction.
+func (p *Parser) RunContract(flags int) (err error) {
 	methods := []string{`init`, `conditions`, `action`, `rollback`}
 	p.TxContract.Extend = p.getExtend()
 	p.TxContract.StackCont = []string{p.TxContract.Name}
@@ -224,27 +249,29 @@ func (p *Parser) CallContract(flags int) (err error) {
 			return fmt.Errorf(`Wrong type of price function`)
 		}
 	}
-	if p.GetFuel().Cmp(decimal.New(0, 0)) <= 0 {
+	if storage.Fuel().Cmp(decimal.New(0, 0)) <= 0 {
 		return fmt.Errorf(`Fuel rate must be greater than 0`)
 	}
-	/*	if (flags&smart.CALL_MAIN) > 0 && !p.CheckContractLimit(price) {
-		return fmt.Errorf(`there are not enough money`)
-	}*/
 	if !p.TxContract.Block.Info.(*script.ContractInfo).Active {
 		return fmt.Errorf(`Contract %s is not active`, p.TxContract.Name)
 	}
 	p.TxContract.FreeRequest = false
 	for i := uint32(0); i < 4; i++ {
 		if (flags & (1 << i)) > 0 {
-			cfunc := p.TxContract.GetFunc(methods[i])
-			if cfunc == nil {
-				continue
-			}
-			p.TxContract.Called = 1 << i
-			_, err = smart.Run(cfunc, nil, p.TxContract.Extend)
+			if cfunc := p.TxContract.GetFunc(methods[i]); cfunc != nil {
+				p.TxContract.Called = 1 << i
+				_, err = smart.Run(cfunc, nil, p.TxContract.Extend)
 
-			if err != nil {
-				break
+				if err != nil {
+					break
+				}
+			}
+			// before action the payer must have money for the price and the resources spent by now.
+			// Only new transactions are checked, so the blocks in the chain are replayed as before.
+			if 1<<i == smart.CALL_FRONT && p.BlockData == nil {
+				if err = p.CheckContractLimit(price, before-(*p.TxContract.Extend)[`txcost`].(int64)); err != nil {
+					break
+				}
 			}
 		}
 	}
@@ -262,7 +289,7 @@ func DBInsert(p *Parser, tblname string, params string, val ...interface{}) (ret
 		cost int64
 		ind  int
 	)
-	if ind, err = p.NumIndexes(tblname); err != nil {
+	if ind, err = storage.NumIndexes(tblname); err != nil {
 		return
 	} else if ind > 0 {
 		cost = int64(ind) * getCost("InsertIndex")
@@ -274,7 +301,7 @@ func DBInsert(p *Parser, tblname string, params string, val ...interface{}) (ret
 		}
 	}
 	var lastId string
-	lastId, err = p.selectiveLoggingAndUpd(strings.Split(params, `,`), val, tblname, nil, nil, true)
+	lastId, err = storage.Update(p, tblname, strings.Split(params, `,`), val, nil, nil)
 	if err == nil {
 		ret, _ = strconv.ParseInt(lastId, 10, 64)
 	}
@@ -299,13 +326,36 @@ func DBInsertReport(p *Parser, tblname string, params string, val ...interface{}
 		return
 	}
 	var lastId string
-	lastId, err = p.selectiveLoggingAndUpd(strings.Split(params, `,`), val, tblname, nil, nil, true)
+	lastId, err = storage.Update(p, tblname, strings.Split(params, `,`), val, nil, nil)
 	if err == nil {
 		ret, _ = strconv.ParseInt(lastId, 10, 64)
 	}
 	return
 }
 
+// Emit writes the event of the contract to the events table. The events are deleted at the rollback of the block.
+func Emit(p *Parser, name string, data map[string]interface{}) error {
+	if len(name) == 0 || len(name) > 100 {
+		return fmt.Errorf(`wrong name of the event`)
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var block int64
+	if p.BlockData != nil {
+		block = p.BlockData.BlockId
+	}
+	contract := p.TxContract.Name
+	if len(p.TxContract.StackCont) > 0 {
+		contract = p.TxContract.StackCont[len(p.TxContract.StackCont)-1]
+	}
+	// the storage returns the error if the block is undefined
+	_, err = storage.Update(p, `events`, []string{`block_id`, `tx_hash`, `state_id`, `contract`, `name`, `data`},
+		[]interface{}{block, p.TxHash, int64(p.TxStateID), contract, name, string(out)}, nil, nil)
+	return err
+}
+
 func checkReport(tblname string) error {
 	if strings.Contains(tblname, `_reports_`) {
 		return fmt.Errorf(`Access denied to report table`)
@@ -325,7 +375,7 @@ func DBUpdate(p *Parser, tblname string, id int64, params string, val ...interfa
 	if err = p.AccessColumns(tblname, columns); err != nil {
 		return
 	}
-	_, err = p.selectiveLoggingAndUpd(columns, val, tblname, []string{`id`}, []string{utils.Int64ToStr(id)}, true)
+	_, err = storage.Update(p, tblname, columns, val, []string{`id`}, []string{utils.Int64ToStr(id)})
 	return
 }
 
@@ -340,12 +390,12 @@ func DBUpdateExt(p *Parser, tblname string, column string, value interface{}, pa
 	if err = p.AccessColumns(tblname, columns); err != nil {
 		return
 	}
-	if isIndex, err = utils.DB.IsIndex(tblname, column); err != nil {
+	if isIndex, err = storage.IsIndex(tblname, column); err != nil {
 		return
 	} else if !isIndex {
 		err = fmt.Errorf(`there is not index on %s`, column)
 	} else {
-		_, err = p.selectiveLoggingAndUpd(columns, val, tblname, []string{column}, []string{fmt.Sprint(value)}, true)
+		_, err = storage.Update(p, tblname, columns, val, []string{column}, []string{fmt.Sprint(value)})
 	}
 	return
 }
@@ -378,7 +428,7 @@ func DBString(tblname string, name string, id int64) (string, error) {
 		return ``, err
 	}
 
-	return utils.DB.Single(`select `+lib.EscapeName(name)+` from `+lib.EscapeName(tblname)+` where id=?`, id).String()
+	return storage.Single(tblname, name, `id=$`, id)
 }
 
 func Sha256(text string) string {
@@ -402,17 +452,21 @@ func DBInt(tblname string, name string, id int64) (int64, error) {
 		return 0, err
 	}
 
-	return utils.DB.Single(`select `+lib.EscapeName(name)+` from `+lib.EscapeName(tblname)+` where id=?`, id).Int64()
+	val, err := storage.Single(tblname, name, `id=$`, id)
+	if err != nil {
+		return 0, err
+	}
+	return utils.StrToInt64(val), nil
 }
 
 func getBytea(table string) map[string]bool {
 	isBytea := make(map[string]bool)
-	colTypes, err := utils.DB.GetAll(`select column_name, data_type from information_schema.columns where table_name=?`, -1, table)
+	colTypes, err := storage.ColumnTypes(table)
 	if err != nil {
 		return isBytea
 	}
-	for _, icol := range colTypes {
-		isBytea[icol[`column_name`]] = icol[`data_type`] == `bytea`
+	for column, dataType := range colTypes {
+		isBytea[column] = dataType == `bytea`
 	}
 	return isBytea
 }
@@ -432,13 +486,12 @@ func DBStringExt(tblname string, name string, id interface{}, idname string) (st
 		}
 	}
 
-	if isIndex, err := utils.DB.IsIndex(tblname, idname); err != nil {
+	if isIndex, err := storage.IsIndex(tblname, idname); err != nil {
 		return ``, err
 	} else if !isIndex {
 		return ``, fmt.Errorf(`there is not index on %s`, idname)
 	}
-	return utils.DB.Single(`select `+lib.EscapeName(name)+` from `+lib.EscapeName(tblname)+` where `+
-		lib.EscapeName(idname)+`=?`, id).String()
+	return storage.Single(tblname, name, lib.EscapeName(idname)+`=$`, id)
 }
 
 func DBIntExt(tblname string, name string, id interface{}, idname string) (ret int64, err error) {
@@ -479,14 +532,13 @@ func DBStringWhere(tblname string, name string, where string, params ...interfac
 		if len(iret) != 2 {
 			continue
 		}
-		if isIndex, err := utils.DB.IsIndex(tblname, iret[1]); err != nil {
+		if isIndex, err := storage.IsIndex(tblname, iret[1]); err != nil {
 			return ``, err
 		} else if !isIndex {
 			return ``, fmt.Errorf(`there is not index on %s`, iret[1])
 		}
 	}
-	return utils.DB.Single(`select `+lib.EscapeName(name)+` from `+lib.EscapeName(tblname)+` where `+
-		strings.Replace(lib.Escape(where), `$`, `?`, -1), params...).String()
+	return storage.Single(tblname, name, where, params...)
 }
 
 func DBIntWhere(tblname string, name string, where string, params ...interface{}) (ret int64, err error) {
@@ -592,7 +644,7 @@ func DBAmount(tblname, column string, id int64) decimal.Decimal {
 		return decimal.New(0, 0)
 	}
 
-	balance, err := utils.DB.Single("SELECT amount FROM "+lib.EscapeName(tblname)+" WHERE "+lib.EscapeName(column)+" = ?", id).String()
+	balance, err := storage.Single(tblname, `amount`, lib.EscapeName(column)+` = $`, id)
 	if err != nil {
 		return decimal.New(0, 0)
 	}
@@ -622,7 +674,7 @@ func (p *Parser) EvalIf(conditions string) (bool, error) {
 }
 
 func StateVal(p *Parser, name string) string {
-	val, _ := utils.StateParam(int64(p.TxStateID), name)
+	val, _ := storage.StateParam(int64(p.TxStateID), name)
 	return val
 }
 
@@ -702,6 +754,9 @@ func UpdateContract(p *Parser, name, value, conditions string) error {
 			root.Children[i].Info.(*script.ContractInfo).Active = cnt[`active`] == `1`
 		}
 	}
+	if len(value) > 0 {
+		utils.CacheContract(prefix, utils.StrToInt64(cnt[`id`]), value, root)
+	}
 	smart.FlushBlock(root)
 
 	return nil
@@ -825,6 +880,7 @@ func UpdatePage(p *Parser, name, value, menu, conditions string) error {
 	if err != nil {
 		return err
 	}
+	utils.InvalidatePage(utils.Int64ToStr(int64(p.TxStateID))+"_pages", name)
 
 	return nil
 }
@@ -841,16 +897,13 @@ func checkWhere(tblname string, where string, order string) (string, string, err
 		if len(iret) != 2 {
 			continue
 		}
-		if isIndex, err := utils.DB.IsIndex(tblname, iret[1]); err != nil {
+		if isIndex, err := storage.IsIndex(tblname, iret[1]); err != nil {
 			return ``, ``, err
 		} else if !isIndex {
 			return ``, ``, fmt.Errorf(`there is not index on %s`, iret[1])
 		}
 	}
-	if len(order) > 0 {
-		order = ` order by ` + lib.EscapeName(order)
-	}
-	return strings.Replace(lib.Escape(where), `$`, `?`, -1), order, nil
+	return where, order, nil
 }
 
 func DBGetList(tblname string, name string, offset, limit int64, order string,
@@ -867,20 +920,16 @@ func DBGetList(tblname string, name string, offset, limit int64, order string,
 		if len(iret) != 2 {
 			continue
 		}
-		if isIndex, err := utils.DB.IsIndex(tblname, iret[1]); err != nil {
+		if isIndex, err := storage.IsIndex(tblname, iret[1]); err != nil {
 			return nil, err
 		} else if !isIndex {
 			return nil, fmt.Errorf(`there is not index on %s`, iret[1])
 		}
 	}
-	if len(order) > 0 {
-		order = ` order by ` + lib.EscapeName(order)
-	}
 	if limit <= 0 {
 		limit = -1
 	}
-	list, err := utils.DB.GetAll(`select `+lib.Escape(name)+` from `+lib.EscapeName(tblname)+` where `+
-		strings.Replace(lib.Escape(where), `$`, `?`, -1)+order+fmt.Sprintf(` offset %d `, offset), int(limit), params...)
+	list, err := storage.GetAll(tblname, strings.Split(lib.Escape(name), `,`), where, order, offset, limit, params...)
 	result := make([]interface{}, len(list))
 	for i := 0; i < len(list); i++ {
 		result[i] = reflect.ValueOf(list[i]).Interface()
@@ -900,8 +949,7 @@ func DBGetTable(tblname string, columns string, offset, limit int64, order strin
 		limit = -1
 	}
 	cols := strings.Split(lib.Escape(columns), `,`)
-	list, err := utils.DB.GetAll(`select `+strings.Join(cols, `,`)+` from `+lib.EscapeName(tblname)+` where `+
-		where+order+fmt.Sprintf(` offset %d `, offset), int(limit), params...)
+	list, err := storage.GetAll(tblname, cols, where, order, offset, limit, params...)
 	result := make([]interface{}, len(list))
 	for i := 0; i < len(list); i++ {
 		//result[i] = make(map[string]interface{})
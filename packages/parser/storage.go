@@ -0,0 +1,120 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/lib"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+	"github.com/shopspring/decimal"
+)
+
+// Storage is the storage of the state tables which is used by DB* and Emit functions of the contracts,
+// by the access checks of the tables and by RunContract. The conditions have $ instead of the parameters.
+type Storage interface {
+	// Update inserts the row if whereFields is empty or there are not rows with whereValues,
+	// otherwise it updates the found rows. It returns id of the inserted or updated row.
+	Update(p *Parser, table string, fields []string, values []interface{}, whereFields, whereValues []string) (string, error)
+	// Single returns the column of the first row which matches the condition
+	Single(table, column, where string, params ...interface{}) (string, error)
+	// GetAll returns the columns of the rows which match the condition. limit < 0 means all rows.
+	GetAll(table string, columns []string, where, order string, offset, limit int64, params ...interface{}) ([]map[string]string, error)
+	IsIndex(table, column string) (bool, error)
+	NumIndexes(table string) (int, error)
+	IsCustomTable(table string) (bool, error)
+	// ColumnTypes returns the types of the columns of the table
+	ColumnTypes(table string) (map[string]string, error)
+	// Permissions returns the conditions from columns_and_permissions of the custom table.
+	// If key is not empty it returns the conditions of the nested object, for example, `update`.
+	Permissions(table, key string) (map[string]string, error)
+	StateParam(state int64, name string) (string, error)
+	Balance(wallet int64) (decimal.Decimal, error)
+	Fuel() decimal.Decimal
+}
+
+// dbStorage is the default storage which works with the database
+type dbStorage struct {
+}
+
+var storage Storage = &dbStorage{}
+
+// SetStorage replaces the storage of the contracts and returns the previous one
+func SetStorage(s Storage) Storage {
+	prev := storage
+	storage = s
+	return prev
+}
+
+func (s *dbStorage) Update(p *Parser, table string, fields []string, values []interface{}, whereFields,
+	whereValues []string) (string, error) {
+	return p.selectiveLoggingAndUpd(fields, values, table, whereFields, whereValues, true)
+}
+
+func (s *dbStorage) Single(table, column, where string, params ...interface{}) (string, error) {
+	return utils.DB.Single(`select `+lib.EscapeName(column)+` from `+lib.EscapeName(table)+` where `+
+		strings.Replace(lib.Escape(where), `$`, `?`, -1), params...).String()
+}
+
+func (s *dbStorage) GetAll(table string, columns []string, where, order string, offset, limit int64,
+	params ...interface{}) ([]map[string]string, error) {
+	if len(order) > 0 {
+		order = ` order by ` + lib.EscapeName(order)
+	}
+	return utils.DB.GetAll(`select `+strings.Join(columns, `,`)+` from `+lib.EscapeName(table)+` where `+
+		strings.Replace(lib.Escape(where), `$`, `?`, -1)+order+fmt.Sprintf(` offset %d `, offset), int(limit), params...)
+}
+
+func (s *dbStorage) IsIndex(table, column string) (bool, error) {
+	return utils.DB.IsIndex(table, column)
+}
+
+func (s *dbStorage) NumIndexes(table string) (int, error) {
+	return utils.DB.NumIndexes(table)
+}
+
+func (s *dbStorage) IsCustomTable(table string) (bool, error) {
+	return utils.DB.IsCustomTable(table)
+}
+
+func (s *dbStorage) ColumnTypes(table string) (map[string]string, error) {
+	return utils.DB.GetMap(`select column_name, data_type from information_schema.columns where table_name=?`,
+		`column_name`, `data_type`, table)
+}
+
+func (s *dbStorage) Permissions(table, key string) (map[string]string, error) {
+	prefix := table[:strings.IndexByte(table, '_')]
+	column := `columns_and_permissions`
+	if len(key) > 0 {
+		column += `->'` + lib.Escape(key) + `'`
+	}
+	return utils.DB.GetMap(`SELECT data.* FROM "`+prefix+`_tables", jsonb_each_text(`+column+`) as data WHERE name = ?`,
+		"key", "value", table)
+}
+
+func (s *dbStorage) StateParam(state int64, name string) (string, error) {
+	return utils.StateParam(state, name)
+}
+
+func (s *dbStorage) Balance(wallet int64) (decimal.Decimal, error) {
+	return utils.Balance(wallet)
+}
+
+func (s *dbStorage) Fuel() decimal.Decimal {
+	return utils.DB.GetFuel()
+}
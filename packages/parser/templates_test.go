@@ -0,0 +1,78 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package parser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/smart"
+)
+
+// TestTemplateContracts checks that the contracts of the shipped applications pass CheckContract,
+// so they can be created by NewContract and EditContract
+func TestTemplateContracts(t *testing.T) {
+	files, err := filepath.Glob(`../../static/*.tpl`)
+	if err != nil || len(files) == 0 {
+		t.Fatalf(`templates are not found %v`, err)
+	}
+	re := regexp.MustCompile("`\\w+ #= (contract\\s[^`]*)`")
+	var id int64
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix := `1`
+		if filepath.Base(file) == `Global.tpl` {
+			prefix = `global`
+		}
+		for _, item := range re.FindAllStringSubmatch(string(data), -1) {
+			if err = smart.CheckContract(item[1], prefix); err != nil {
+				t.Errorf(`%s: %v`, filepath.Base(file), err)
+			}
+			// the contract is added as NewContract does, the next contracts can call it
+			id++
+			if err = smart.Compile(item[1], prefix, true, id); err != nil {
+				t.Errorf(`%s: %v`, filepath.Base(file), err)
+			}
+		}
+	}
+}
+
+// TestTemplatePages checks that the pages of the shipped applications pass checkPage,
+// so they can be created by NewPage and EditPage
+func TestTemplatePages(t *testing.T) {
+	files, err := filepath.Glob(`../../static/*.tpl`)
+	if err != nil || len(files) == 0 {
+		t.Fatalf(`templates are not found %v`, err)
+	}
+	re := regexp.MustCompile("`p_(\\w+) #= ([^`]*)`")
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range re.FindAllStringSubmatch(string(data), -1) {
+			if err = checkPage(item[2]); err != nil {
+				t.Errorf(`%s %s: %v`, filepath.Base(file), item[1], err)
+			}
+		}
+	}
+}
@@ -24,7 +24,47 @@ import (
 var (
 	log = logging.MustGetLogger("daemons")
 )
+// updates are applied at every start, so they must not fail if they have been applied already.
+// They don't depend on consts.VERSION, because the new tables and columns are required by the code
+// even if the version of the database is the same.
+var updates = []string{
+	// tx_hash and the index by block_id are used by the history of exchangeapi
+	`ALTER TABLE dlt_transactions ADD COLUMN IF NOT EXISTS tx_hash bytea NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS dlt_transactions_index_block ON dlt_transactions (block_id)`,
+	// the address book of the nodes
+	`CREATE TABLE IF NOT EXISTS "peers" ("host" varchar(100) NOT NULL DEFAULT '' PRIMARY KEY,
+		"last_seen" int NOT NULL DEFAULT '0', "latency" int NOT NULL DEFAULT '0',
+		"block_id" int NOT NULL DEFAULT '0', "ban_score" int NOT NULL DEFAULT '0',
+		"ban_time" int NOT NULL DEFAULT '0')`,
+	// the node which has sent the host to the address book
+	`ALTER TABLE peers ADD COLUMN IF NOT EXISTS source varchar(100) NOT NULL DEFAULT ''`,
+	// the log of the reorganizations of the chain
+	`CREATE TABLE IF NOT EXISTS "reorg_log" ("id" bigserial PRIMARY KEY, "time" int NOT NULL DEFAULT '0',
+		"host" varchar(100) NOT NULL DEFAULT '', "fork_block_id" int NOT NULL DEFAULT '0',
+		"depth" int NOT NULL DEFAULT '0', "old_block_id" int NOT NULL DEFAULT '0',
+		"old_hash" bytea NOT NULL DEFAULT '', "new_block_id" int NOT NULL DEFAULT '0',
+		"new_hash" bytea NOT NULL DEFAULT '', "status" varchar(20) NOT NULL DEFAULT '',
+		"reason" text NOT NULL DEFAULT '', "error" text NOT NULL DEFAULT '')`,
+	// the compiled contracts which are loaded at the start instead of compiling the sources
+	`CREATE TABLE IF NOT EXISTS "smart_contracts_cache" ("prefix" varchar(32) NOT NULL DEFAULT '',
+		"id" bigint NOT NULL DEFAULT '0', "hash" varchar(64) NOT NULL DEFAULT '',
+		"version" int NOT NULL DEFAULT '0', "code" bytea NOT NULL DEFAULT '', PRIMARY KEY (prefix, id))`,
+	// the events which are emitted by the contracts
+	`CREATE TABLE IF NOT EXISTS "events" ("id" bigserial PRIMARY KEY, "block_id" bigint NOT NULL DEFAULT '0',
+		"tx_hash" bytea NOT NULL DEFAULT '', "state_id" bigint NOT NULL DEFAULT '0',
+		"contract" varchar(100) NOT NULL DEFAULT '', "name" varchar(100) NOT NULL DEFAULT '',
+		"data" jsonb, "rb_id" bigint NOT NULL DEFAULT '0')`,
+	`CREATE INDEX IF NOT EXISTS events_index_block ON "events" (block_id)`,
+	`CREATE INDEX IF NOT EXISTS events_index_name ON "events" (state_id, contract, name)`,
+}
+
 func Migration() {
+	for _, query := range updates {
+		if err := utils.DB.ExecSql(query); err != nil {
+			log.Error("%v", utils.ErrInfo(err))
+		}
+	}
+
 	oldDbVersion, err := utils.DB.Single(`SELECT version FROM migration_history ORDER BY id DESC LIMIT 1`).String()
 	if err != nil {
 		log.Error("%v", utils.ErrInfo(err))
@@ -35,11 +75,9 @@ func Migration() {
 
 	log.Debug("*utils.OldVersion %v", *utils.OldVersion)
 	if len(*utils.OldVersion) > 0 {
-
 		err = utils.DB.ExecSql(`INSERT INTO migration_history (version, date_applied) VALUES (?, ?)`, consts.VERSION, utils.Time())
 		if err != nil {
 			log.Error("%v", utils.ErrInfo(err))
 		}
 	}
 }
-
@@ -0,0 +1,289 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// TypeItem is the type of the value on the stack which is known at compile time.
+// Type is nil if the type can be known only at run time.
+type TypeItem struct {
+	Type  reflect.Type
+	Const bool // the value is a literal or the result of operations with literals
+}
+
+// callInfo is the information about the call of the function in the source code
+type callInfo struct {
+	Lexem    *Lexem // the name of the function
+	Args     int    // count of parameters in the source code
+	Hidden   int    // count of parameters which are pushed by the compiler
+	Contract bool   // the call of the contract
+}
+
+var (
+	typeMoney = TYPES[`money`]
+	typeBool  = TYPES[`bool`]
+	typeInt   = TYPES[`int`]
+	typeFloat = TYPES[`float`]
+	typeStr   = TYPES[`string`]
+)
+
+// typeName returns the name of the type in the contract language
+func typeName(t reflect.Type) string {
+	for name, itype := range TYPES {
+		if itype == t {
+			return name
+		}
+	}
+	return t.String()
+}
+
+func isUnknown(t reflect.Type) bool {
+	return t == nil || t.Kind() == reflect.Interface
+}
+
+// assignable checks if the value can be assigned to the variable of dst type
+func assignable(src TypeItem, dst reflect.Type) bool {
+	if isUnknown(src.Type) || isUnknown(dst) || src.Type.AssignableTo(dst) {
+		return true
+	}
+	switch dst {
+	case typeMoney:
+		// money accepts integers, floats and strings, they are converted with ValueToDecimal
+		return src.Type == typeStr || src.Type == typeFloat || src.Type == typeInt
+	case typeBool:
+		// numeric values are treated as bool by valueToBool
+		return src.Type == typeInt || src.Type == typeFloat || src.Type == typeMoney
+	}
+	return false
+}
+
+// binaryType returns the type of the result of the binary operation
+func binaryType(cmd uint16, left, right TypeItem) TypeItem {
+	ret := TypeItem{Const: left.Const && right.Const}
+	switch cmd {
+	case CMD_ADD, CMD_SUB, CMD_MUL, CMD_DIV:
+	default:
+		ret.Type = typeBool
+		return ret
+	}
+	switch {
+	case isUnknown(left.Type) || isUnknown(right.Type):
+	case left.Type == typeMoney || right.Type == typeMoney:
+		ret.Type = typeMoney
+	case left.Type == right.Type:
+		ret.Type = left.Type
+	case left.Type == typeStr && (right.Type == typeInt || right.Type == typeFloat):
+		ret.Type = right.Type
+	case left.Type == typeFloat && right.Type == typeInt:
+		ret.Type = typeFloat
+	}
+	return ret
+}
+
+// checkEval gets the bytecode of the expression and checks the parameters of the called functions.
+// It returns the types of the values which the expression leaves on the stack.
+func checkEval(bytecode ByteCodes, calls map[*ByteCode]*callInfo) ([]TypeItem, error) {
+	stack := make([]TypeItem, 0, 16)
+	exact := true
+	pop := func(count int) []TypeItem {
+		if count > len(stack) {
+			exact = false
+			count = len(stack)
+		}
+		ret := stack[len(stack)-count:]
+		stack = stack[:len(stack)-count]
+		return ret
+	}
+	for _, cmd := range bytecode {
+		switch cmd.Cmd {
+		case CMD_PUSH:
+			stack = append(stack, TypeItem{reflect.TypeOf(cmd.Value), true})
+		case CMD_PUSHSTR:
+			stack = append(stack, TypeItem{typeStr, true})
+		case CMD_VAR:
+			var itype reflect.Type
+			if ivar := cmd.Value.(*VarInfo); ivar.Owner != nil && ivar.Obj.Type == OBJ_VAR {
+				itype = ivar.Owner.Vars[ivar.Obj.Value.(int)]
+			}
+			stack = append(stack, TypeItem{Type: itype})
+		case CMD_EXTEND:
+			stack = append(stack, TypeItem{})
+		case CMD_CALLEXTEND:
+			// the count of parameters and results is known only at run time
+			exact = false
+			stack = append(stack, TypeItem{})
+		case CMD_INDEX:
+			pop(2)
+			stack = append(stack, TypeItem{})
+		case CMD_SETINDEX:
+			pop(3)
+		case CMD_NOT:
+			pop(1)
+			stack = append(stack, TypeItem{Type: typeBool})
+		case CMD_SIGN:
+		case CMD_CALL, CMD_CALLVARI:
+			if calls[cmd] == nil {
+				exact = false
+				continue
+			}
+			results, err := checkCall(cmd, calls[cmd], pop, exact)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, results...)
+		default:
+			if cmd.Cmd>>8 == 2 {
+				args := pop(2)
+				if len(args) == 2 {
+					stack = append(stack, binaryType(cmd.Cmd, args[0], args[1]))
+				} else {
+					stack = append(stack, TypeItem{})
+				}
+			}
+		}
+	}
+	if !exact {
+		return nil, nil
+	}
+	return stack, nil
+}
+
+// checkCall checks the count and the types of parameters of the function call
+func checkCall(cmd *ByteCode, call *callInfo, pop func(int) []TypeItem, exact bool) ([]TypeItem, error) {
+	var (
+		params, results []reflect.Type
+		variadic        bool
+	)
+	obj := cmd.Value.(*ObjInfo)
+	isExt := obj.Type == OBJ_EXTFUNC
+	if isExt {
+		finfo := obj.Value.(ExtFuncInfo)
+		for i, par := range finfo.Params {
+			if len(finfo.Auto[i]) == 0 {
+				params = append(params, par)
+			}
+		}
+		for _, res := range finfo.Results {
+			if res.String() != `error` {
+				results = append(results, res)
+			}
+		}
+		variadic = finfo.Variadic
+	} else {
+		finfo := obj.Value.(*Block).Info.(*FuncInfo)
+		params, results, variadic = finfo.Params, finfo.Results, finfo.Variadic
+	}
+	if cmd.Cmd == CMD_CALLVARI {
+		pop(1)
+	}
+	args := pop(call.Args + call.Hidden)
+	ret := make([]TypeItem, len(results))
+	for i, res := range results {
+		ret[i].Type = res
+	}
+	if call.Contract {
+		return ret, nil
+	}
+	name, count := call.Lexem.Value, call.Args+call.Hidden
+	if (variadic && count < len(params)-1) || (!variadic && count != len(params)) {
+		return nil, fmt.Errorf(`wrong number of parameters in %v (%d instead of %d) [Ln:%d Col:%d]`,
+			name, call.Args, len(params)-call.Hidden, call.Lexem.Line, call.Lexem.Column)
+	}
+	if !exact || len(args) != count {
+		return ret, nil
+	}
+	for i, arg := range args {
+		var par reflect.Type
+		if variadic && i >= len(params)-1 {
+			par = params[len(params)-1].Elem()
+		} else {
+			par = params[i]
+		}
+		ok := assignable(arg, par)
+		if isExt {
+			// the values are passed to golang function without any conversion
+			ok = isUnknown(arg.Type) || isUnknown(par) || arg.Type.AssignableTo(par)
+		}
+		if !ok {
+			return nil, fmt.Errorf(`wrong type of parameter %d in %v (%s instead of %s) [Ln:%d Col:%d]`,
+				i+1-call.Hidden, name, typeName(arg.Type), typeName(par), call.Lexem.Line, call.Lexem.Column)
+		}
+	}
+	return ret, nil
+}
+
+// checkAssign checks the types of values which are assigned to the variables
+func checkAssign(assign []*VarInfo, types []TypeItem, lexem *Lexem) error {
+	if types == nil {
+		return nil
+	}
+	if len(types) != len(assign) {
+		return fmt.Errorf(`wrong number of values in assignment (%d instead of %d) [Ln:%d Col:%d]`,
+			len(types), len(assign), lexem.Line, lexem.Column)
+	}
+	for i, item := range assign {
+		if item.Owner == nil {
+			continue
+		}
+		vtype := item.Owner.Vars[item.Obj.Value.(int)]
+		if !assignable(types[i], vtype) {
+			return fmt.Errorf(`cannot assign %s to %s variable [Ln:%d Col:%d]`, typeName(types[i].Type),
+				typeName(vtype), lexem.Line, lexem.Column)
+		}
+	}
+	return nil
+}
+
+// checkReturn checks the count and the types of the returned values
+func checkReturn(block *Block, types []TypeItem, lexem *Lexem) error {
+	if types == nil || block == nil {
+		return nil
+	}
+	results := block.Info.(*FuncInfo).Results
+	if len(types) != len(results) {
+		return fmt.Errorf(`wrong number of return values (%d instead of %d) [Ln:%d Col:%d]`,
+			len(types), len(results), lexem.Line, lexem.Column)
+	}
+	for i, res := range results {
+		if !assignable(types[i], res) {
+			return fmt.Errorf(`cannot return %s as %s [Ln:%d Col:%d]`, typeName(types[i].Type),
+				typeName(res), lexem.Line, lexem.Column)
+		}
+	}
+	return nil
+}
+
+// checkUnused returns the error if there are declared variables which are never used
+func checkUnused(vars map[*ObjInfo]*Lexem) error {
+	if len(vars) == 0 {
+		return nil
+	}
+	unused := make([]*Lexem, 0, len(vars))
+	for _, lexem := range vars {
+		unused = append(unused, lexem)
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].Line < unused[j].Line ||
+			(unused[i].Line == unused[j].Line && unused[i].Column < unused[j].Column)
+	})
+	return fmt.Errorf(`variable %v is declared but not used [Ln:%d Col:%d]`, unused[0].Value,
+		unused[0].Line, unused[0].Column)
+}
@@ -41,6 +41,7 @@ const (
 	CMD_INDEX             // get index []
 	CMD_SETINDEX          // set index []
 	CMD_ERROR             // error command
+	CMD_FOR               // for loop over array or map
 )
 
 const (
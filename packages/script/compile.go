@@ -55,6 +55,7 @@ const (
 	STATE_ASSIGN
 	STATE_TX
 	STATE_FIELDS
+	STATE_FOR
 
 	STATE_EVAL
 
@@ -102,6 +103,9 @@ const (
 	CF_BREAK
 	CF_CMDERROR
 	CF_EVAL
+	CF_FORVAR
+	CF_FOR
+	CF_FORCOMMA
 )
 
 var (
@@ -130,6 +134,10 @@ var (
 		fContinue,
 		fBreak,
 		fCmdError,
+		nil, // CF_EVAL
+		fForVar,
+		fFor,
+		fForComma,
 	}
 	states = States{
 		{ // STATE_ROOT
@@ -147,6 +155,7 @@ var (
 			LEX_KEYWORD | (KEY_BREAK << 8):    {STATE_BODY, CF_BREAK},
 			LEX_KEYWORD | (KEY_IF << 8):       {STATE_EVAL | STATE_PUSH | STATE_TOBLOCK | STATE_MUSTEVAL, CF_IF},
 			LEX_KEYWORD | (KEY_WHILE << 8):    {STATE_EVAL | STATE_PUSH | STATE_TOBLOCK | STATE_LABEL | STATE_MUSTEVAL, CF_WHILE},
+			LEX_KEYWORD | (KEY_FOR << 8):      {STATE_FOR | STATE_PUSH, 0},
 			LEX_KEYWORD | (KEY_ELSE << 8):     {STATE_BLOCK | STATE_PUSH, CF_ELSE},
 			LEX_KEYWORD | (KEY_VAR << 8):      {STATE_VAR, 0},
 			LEX_KEYWORD | (KEY_TX << 8):       {STATE_TX, CF_TX},
@@ -247,6 +256,12 @@ var (
 			IS_RCURLY:   {STATE_TOBODY, 0},
 			0:           {ERR_MUSTRCURLY, CF_ERROR},
 		},
+		{ // STATE_FOR
+			LEX_IDENT:                   {STATE_FOR, CF_FORVAR},
+			IS_COMMA:                    {STATE_FOR, CF_FORCOMMA},
+			LEX_KEYWORD | (KEY_IN << 8): {STATE_EVAL | STATE_TOBLOCK | STATE_MUSTEVAL, CF_FOR},
+			0:                           {ERR_VARS, CF_ERROR},
+		},
 	}
 )
 
@@ -276,12 +291,12 @@ func fFuncResult(buf *[]*Block, state int, lexem *Lexem) error {
 
 func fReturn(buf *[]*Block, state int, lexem *Lexem) error {
 	//	fblock := (*buf)[len(*buf)-1].Info.(*FuncInfo)
-	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, &ByteCode{CMD_RETURN, 0}) //len(fblock.Results)})
+	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, newByteCode(CMD_RETURN, 0, lexem)) //len(fblock.Results)})
 	return nil
 }
 
 func fCmdError(buf *[]*Block, state int, lexem *Lexem) error {
-	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, &ByteCode{CMD_ERROR, lexem.Value})
+	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, newByteCode(CMD_ERROR, lexem.Value, lexem))
 	return nil
 }
 
@@ -318,23 +333,65 @@ func fFtype(buf *[]*Block, state int, lexem *Lexem) error {
 }
 
 func fIf(buf *[]*Block, state int, lexem *Lexem) error {
-	(*(*buf)[len(*buf)-2]).Code = append((*(*buf)[len(*buf)-2]).Code, &ByteCode{CMD_IF, (*buf)[len(*buf)-1]})
+	(*(*buf)[len(*buf)-2]).Code = append((*(*buf)[len(*buf)-2]).Code, newByteCode(CMD_IF, (*buf)[len(*buf)-1], lexem))
 	return nil
 }
 
 func fWhile(buf *[]*Block, state int, lexem *Lexem) error {
-	(*(*buf)[len(*buf)-2]).Code = append((*(*buf)[len(*buf)-2]).Code, &ByteCode{CMD_WHILE, (*buf)[len(*buf)-1]})
-	(*(*buf)[len(*buf)-2]).Code = append((*(*buf)[len(*buf)-2]).Code, &ByteCode{CMD_CONTINUE, 0})
+	(*(*buf)[len(*buf)-2]).Code = append((*(*buf)[len(*buf)-2]).Code, newByteCode(CMD_WHILE, (*buf)[len(*buf)-1], lexem))
+	(*(*buf)[len(*buf)-2]).Code = append((*(*buf)[len(*buf)-2]).Code, newByteCode(CMD_CONTINUE, 0, lexem))
+	return nil
+}
+
+func fForVar(buf *[]*Block, state int, lexem *Lexem) error {
+	block := (*buf)[len(*buf)-1]
+	if block.Info == nil {
+		block.Info = &ForInfo{}
+	}
+	info := block.Info.(*ForInfo)
+	if info.Vars > 0 && !info.Comma {
+		return fmt.Errorf(`expecting comma between for variables [Ln:%d Col:%d]`, lexem.Line, lexem.Column)
+	}
+	info.Comma = false
+	if block.Objects == nil {
+		block.Objects = make(map[string]*ObjInfo)
+	}
+	block.Objects[lexem.Value.(string)] = &ObjInfo{Type: OBJ_VAR, Value: len(block.Vars)}
+	block.Vars = append(block.Vars, reflect.TypeOf((*interface{})(nil)).Elem())
+	info.Vars++
+	return nil
+}
+
+// fForComma checks that the comma separates the variables of for
+func fForComma(buf *[]*Block, state int, lexem *Lexem) error {
+	info, ok := (*buf)[len(*buf)-1].Info.(*ForInfo)
+	if !ok || info.Comma {
+		return fmt.Errorf(`unexpected comma in for [Ln:%d Col:%d]`, lexem.Line, lexem.Column)
+	}
+	info.Comma = true
+	return nil
+}
+
+// fFor moves the code of the iterated expression from the loop block to the parent block
+func fFor(buf *[]*Block, state int, lexem *Lexem) error {
+	block := (*buf)[len(*buf)-1]
+	if info, ok := block.Info.(*ForInfo); !ok || info.Vars > 2 || info.Comma {
+		return fmt.Errorf(`for must have one or two variables [Ln:%d Col:%d]`, lexem.Line, lexem.Column)
+	}
+	parent := (*buf)[len(*buf)-2]
+	parent.Code = append(parent.Code, block.Code...)
+	parent.Code = append(parent.Code, newByteCode(CMD_FOR, block, lexem))
+	block.Code = nil
 	return nil
 }
 
 func fContinue(buf *[]*Block, state int, lexem *Lexem) error {
-	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, &ByteCode{CMD_CONTINUE, 0})
+	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, newByteCode(CMD_CONTINUE, 0, lexem))
 	return nil
 }
 
 func fBreak(buf *[]*Block, state int, lexem *Lexem) error {
-	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, &ByteCode{CMD_BREAK, 0})
+	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, newByteCode(CMD_BREAK, 0, lexem))
 	return nil
 }
 
@@ -361,15 +418,15 @@ func fAssignVar(buf *[]*Block, state int, lexem *Lexem) error {
 	}
 	prev = append(prev, &ivar)
 	if len(prev) == 1 {
-		(*(*buf)[len(*buf)-1]).Code = append((*block).Code, &ByteCode{CMD_ASSIGNVAR, prev})
+		(*(*buf)[len(*buf)-1]).Code = append((*block).Code, newByteCode(CMD_ASSIGNVAR, prev, lexem))
 	} else {
-		(*(*buf)[len(*buf)-1]).Code[len(block.Code)-1] = &ByteCode{CMD_ASSIGNVAR, prev}
+		(*(*buf)[len(*buf)-1]).Code[len(block.Code)-1] = newByteCode(CMD_ASSIGNVAR, prev, lexem)
 	}
 	return nil
 }
 
 func fAssign(buf *[]*Block, state int, lexem *Lexem) error {
-	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, &ByteCode{CMD_ASSIGN, 0})
+	(*(*buf)[len(*buf)-1]).Code = append((*(*buf)[len(*buf)-1]).Code, newByteCode(CMD_ASSIGN, 0, lexem))
 	return nil
 }
 
@@ -414,10 +471,31 @@ func fElse(buf *[]*Block, state int, lexem *Lexem) error {
 	if code[len(code)-1].Cmd != CMD_IF {
 		return fmt.Errorf(`there is not if before %v [Ln:%d Col:%d]`, lexem.Type, lexem.Line, lexem.Column)
 	}
-	(*(*buf)[len(*buf)-2]).Code = append(code, &ByteCode{CMD_ELSE, (*buf)[len(*buf)-1]})
+	(*(*buf)[len(*buf)-2]).Code = append(code, newByteCode(CMD_ELSE, (*buf)[len(*buf)-1], lexem))
 	return nil
 }
 
+// tableName returns the name of the table from the first parameter of the function if it is
+// a string constant or Table("name"). Otherwise, it returns *. The global contracts and TABLE_ANY functions
+// get *_name for Table("name").
+func (vm *VM) tableName(lexems *Lexems, i int, state uint32) string {
+	lex := *lexems
+	isEnd := func(i int) bool {
+		return i < len(lex) && (lex[i].Type == IS_COMMA || lex[i].Type == IS_RPAR)
+	}
+	if i < len(lex) && lex[i].Type == LEX_STRING && isEnd(i+1) {
+		return lex[i].Value.(string)
+	}
+	if i+3 < len(lex) && lex[i].Type == LEX_IDENT && vm.TableFuncs[lex[i].Value.(string)]&TABLE_PREFIX != 0 &&
+		lex[i+1].Type == IS_LPAR && lex[i+2].Type == LEX_STRING && lex[i+3].Type == IS_RPAR && isEnd(i+4) {
+		if state == 0 || vm.TableFuncs[lex[i].Value.(string)]&TABLE_ANY != 0 {
+			return `*_` + lex[i+2].Value.(string)
+		}
+		return fmt.Sprintf(`%d_%s`, state, lex[i+2].Value.(string))
+	}
+	return `*`
+}
+
 func StateName(state uint32, name string) string {
 	if name[0] != '@' {
 		return fmt.Sprintf(`@%d%s`, state, name)
@@ -447,7 +525,20 @@ func fNameBlock(buf *[]*Block, state int, lexem *Lexem) error {
 	return nil
 }
 
+// CompileBlock compiles the source code. It checks only the syntax, so the contracts which have been
+// already deployed are compiled in the same way on all nodes.
 func (vm *VM) CompileBlock(input []rune, idstate uint32, active bool, tblid int64) (*Block, error) {
+	return vm.compileBlock(input, idstate, active, tblid, false)
+}
+
+// CheckBlock compiles the new source code with the additional checks of the calls, assignments,
+// returns and unused variables. The compiled block is not added to the virtual machine.
+func (vm *VM) CheckBlock(input []rune, idstate uint32) error {
+	_, err := vm.compileBlock(input, idstate, false, 0, true)
+	return err
+}
+
+func (vm *VM) compileBlock(input []rune, idstate uint32, active bool, tblid int64, check bool) (*Block, error) {
 	root := &Block{Info: idstate, Active: active, TblId: tblid}
 	lexems, err := LexParser(input)
 	if err != nil {
@@ -461,6 +552,10 @@ func (vm *VM) CompileBlock(input []rune, idstate uint32, active bool, tblid int6
 	blockstack := make([]*Block, 1, 64)
 	blockstack[0] = root
 	fork := 0
+	var vars map[*ObjInfo]*Lexem // declared variables which have not been used yet
+	if check {
+		vars = make(map[*ObjInfo]*Lexem)
+	}
 
 	for i := 0; i < len(lexems); i++ {
 		var (
@@ -491,12 +586,27 @@ func (vm *VM) CompileBlock(input []rune, idstate uint32, active bool, tblid int6
 		}
 		if nextState == STATE_EVAL {
 			if newState.NewState&STATE_LABEL > 0 {
-				(*blockstack[len(blockstack)-1]).Code = append((*blockstack[len(blockstack)-1]).Code, &ByteCode{CMD_LABEL, 0})
+				(*blockstack[len(blockstack)-1]).Code = append((*blockstack[len(blockstack)-1]).Code, newByteCode(CMD_LABEL, 0, lexem))
 			}
 			curlen := len((*blockstack[len(blockstack)-1]).Code)
-			if err := vm.compileEval(&lexems, &i, &blockstack); err != nil {
+			types, err := vm.compileEval(&lexems, &i, &blockstack, vars)
+			if err != nil {
 				return nil, err
 			}
+			if check {
+				switch newState.Func {
+				case CF_ASSIGN:
+					code := (*blockstack[len(blockstack)-1]).Code
+					if curlen > 0 && code[curlen-1].Cmd == CMD_ASSIGNVAR {
+						err = checkAssign(code[curlen-1].Value.([]*VarInfo), types, lexem)
+					}
+				case CF_RETURN:
+					err = checkReturn(funcBlock(blockstack), types, lexem)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
 			if (newState.NewState&STATE_MUSTEVAL) > 0 && curlen == len((*blockstack[len(blockstack)-1]).Code) {
 				return nil, fmt.Errorf("there is not eval expression")
 			}
@@ -526,7 +636,7 @@ func (vm *VM) CompileBlock(input []rune, idstate uint32, active bool, tblid int6
 				if len(prev.Code) > 0 && (*prev).Code[len((*prev).Code)-1].Cmd == CMD_CONTINUE {
 					(*prev).Code = (*prev).Code[:len((*prev).Code)-1]
 					prev = blockstack[len(blockstack)-1]
-					(*prev).Code = append((*prev).Code, &ByteCode{CMD_CONTINUE, 0})
+					(*prev).Code = append((*prev).Code, newByteCode(CMD_CONTINUE, 0, lexem))
 				}
 			}
 			blockstack = blockstack[:len(blockstack)-1]
@@ -545,6 +655,9 @@ func (vm *VM) CompileBlock(input []rune, idstate uint32, active bool, tblid int6
 			if err := funcs[newState.Func](&blockstack, nextState, lexem); err != nil {
 				return nil, err
 			}
+			if check && newState.Func == CF_FPARAM && nextState == STATE_VARTYPE {
+				vars[blockstack[len(blockstack)-1].Objects[lexem.Value.(string)]] = lexem
+			}
 			//		fmt.Println(`Block Func`, *blockstack[len(blockstack)-1], len(blockstack)-1)
 		}
 		curState = nextState
@@ -552,6 +665,11 @@ func (vm *VM) CompileBlock(input []rune, idstate uint32, active bool, tblid int6
 	if len(stack) > 0 {
 		return nil, fError(&blockstack, ERR_MUSTRCURLY, lexems[len(lexems)-1])
 	}
+	if check {
+		if err := checkUnused(vars); err != nil {
+			return nil, err
+		}
+	}
 	//	shift := len(vm.Children)
 	//	fmt.Println(`Root`, blockstack[0])
 	//	fmt.Println(`VM`, vm)
@@ -627,14 +745,40 @@ func (vm *VM) findObj(name string, block *[]*Block) (ret *ObjInfo, owner *Block)
 	return
 }
 
-func (vm *VM) compileEval(lexems *Lexems, ind *int, block *[]*Block) error {
+// newByteCode creates the bytecode command with the position of the lexem in the source code
+func newByteCode(cmd uint16, value interface{}, lexem *Lexem) *ByteCode {
+	return &ByteCode{Cmd: cmd, Value: value, Line: lexem.Line, Column: lexem.Column}
+}
+
+// unknownError returns the error of the unknown name. The position is added if the source code is checked.
+func unknownError(kind string, lexem *Lexem, check bool) error {
+	if check {
+		return fmt.Errorf(`unknown %s %s [Ln:%d Col:%d]`, kind, lexem.Value.(string), lexem.Line, lexem.Column)
+	}
+	return fmt.Errorf(`unknown %s %s`, kind, lexem.Value.(string))
+}
+
+// funcBlock returns the function which is being compiled
+func funcBlock(blockstack []*Block) *Block {
+	for i := len(blockstack) - 1; i >= 0; i-- {
+		if blockstack[i].Type == OBJ_FUNC {
+			return blockstack[i]
+		}
+	}
+	return nil
+}
+
+// compileEval compiles the expression. vars is nil if the source code is not checked, in this case
+// the types of the expression are not returned.
+func (vm *VM) compileEval(lexems *Lexems, ind *int, block *[]*Block, vars map[*ObjInfo]*Lexem) ([]TypeItem, error) {
 	i := *ind
 	curBlock := (*block)[len(*block)-1]
+	calls := make(map[*ByteCode]*callInfo)
 
 	buffer := make(ByteCodes, 0, 20)
 	bytecode := make(ByteCodes, 0, 100)
 	parcount := make([]int, 0, 20)
-	setIndex := false
+	var setIndex *ByteCode
 	//	mode := 0
 main:
 	for ; i < len(*lexems); i++ {
@@ -657,9 +801,9 @@ main:
 			}
 			break main
 		case IS_LPAR:
-			buffer = append(buffer, &ByteCode{CMD_SYS, uint16(0xff)})
+			buffer = append(buffer, newByteCode(CMD_SYS, uint16(0xff), lexem))
 		case IS_LBRACK:
-			buffer = append(buffer, &ByteCode{CMD_SYS, uint16(0xff)})
+			buffer = append(buffer, newByteCode(CMD_SYS, uint16(0xff), lexem))
 		case IS_COMMA:
 			if len(parcount) > 0 {
 				parcount[len(parcount)-1]++
@@ -676,7 +820,7 @@ main:
 		case IS_RPAR:
 			for {
 				if len(buffer) == 0 {
-					return fmt.Errorf(`there is not pair`)
+					return nil, fmt.Errorf(`there is not pair`)
 				} else {
 					prev := buffer[len(buffer)-1]
 					buffer = buffer[:len(buffer)-1]
@@ -691,8 +835,11 @@ main:
 				if prev := buffer[len(buffer)-1]; prev.Cmd == CMD_CALL || prev.Cmd == CMD_CALLVARI {
 					count := parcount[len(parcount)-1]
 					parcount = parcount[:len(parcount)-1]
+					if call, ok := calls[prev]; ok {
+						call.Args = count
+					}
 					if prev.Cmd == CMD_CALLVARI {
-						bytecode = append(bytecode, &ByteCode{CMD_PUSH, count})
+						bytecode = append(bytecode, newByteCode(CMD_PUSH, count, lexem))
 					}
 					buffer = buffer[:len(buffer)-1]
 					bytecode = append(bytecode, prev)
@@ -701,7 +848,7 @@ main:
 		case IS_RBRACK:
 			for {
 				if len(buffer) == 0 {
-					return fmt.Errorf(`there is not pair`)
+					return nil, fmt.Errorf(`there is not pair`)
 				} else {
 					prev := buffer[len(buffer)-1]
 					buffer = buffer[:len(buffer)-1]
@@ -717,7 +864,7 @@ main:
 					buffer = buffer[:len(buffer)-1]
 					if i < len(*lexems)-1 && (*lexems)[i+1].Type == IS_EQ {
 						i++
-						setIndex = true
+						setIndex = newByteCode(CMD_SETINDEX, 0, (*lexems)[i])
 						continue
 					}
 					bytecode = append(bytecode, prev)
@@ -730,7 +877,7 @@ main:
 					oper.Cmd = CMD_SIGN
 					oper.Priority = UNARY
 				}
-				byteOper := &ByteCode{oper.Cmd, oper.Priority}
+				byteOper := newByteCode(oper.Cmd, oper.Priority, lexem)
 				for {
 					if len(buffer) == 0 {
 						buffer = append(buffer, byteOper)
@@ -755,10 +902,10 @@ main:
 					}
 				}
 			} else {
-				return fmt.Errorf(`unknown operator %s`, lexem.Value.(uint32))
+				return nil, fmt.Errorf(`unknown operator %d`, lexem.Value.(uint32))
 			}
 		case LEX_NUMBER, LEX_STRING:
-			cmd = &ByteCode{CMD_PUSH, lexem.Value}
+			cmd = newByteCode(CMD_PUSH, lexem.Value, lexem)
 		case LEX_EXTEND:
 			if i < len(*lexems)-2 {
 				if (*lexems)[i+1].Type == IS_LPAR {
@@ -767,20 +914,20 @@ main:
 						count++
 					}
 					parcount = append(parcount, count)
-					buffer = append(buffer, &ByteCode{CMD_CALLEXTEND, lexem.Value.(string)})
+					buffer = append(buffer, newByteCode(CMD_CALLEXTEND, lexem.Value.(string), lexem))
 					call = true
 				}
 			}
 			if !call {
-				cmd = &ByteCode{CMD_EXTEND, lexem.Value.(string)}
+				cmd = newByteCode(CMD_EXTEND, lexem.Value.(string), lexem)
 				if (*lexems)[i+1].Type == IS_LBRACK {
-					buffer = append(buffer, &ByteCode{CMD_INDEX, 0})
+					buffer = append(buffer, newByteCode(CMD_INDEX, 0, lexem))
 				}
 			}
 		case LEX_IDENT:
 			objInfo, tobj := vm.findObj(lexem.Value.(string), block)
 			if objInfo == nil && (!vm.Extern || i >= len(*lexems)-2 || (*lexems)[i+1].Type != IS_LPAR) {
-				return fmt.Errorf(`unknown identifier %s`, lexem.Value.(string))
+				return nil, unknownError(`identifier`, lexem, vars != nil)
 			}
 			if i < len(*lexems)-2 {
 				if (*lexems)[i+1].Type == IS_LPAR {
@@ -790,7 +937,7 @@ main:
 					}
 					if objInfo == nil || (objInfo.Type != OBJ_EXTFUNC && objInfo.Type != OBJ_FUNC &&
 						objInfo.Type != OBJ_CONTRACT) {
-						return fmt.Errorf(`unknown function %s`, lexem.Value.(string))
+						return nil, unknownError(`function`, lexem, vars != nil)
 					}
 					if objInfo.Type == OBJ_CONTRACT {
 						objInfo, tobj = vm.findObj(`ExecContract`, block)
@@ -805,7 +952,9 @@ main:
 					if (*lexems)[i+2].Type != IS_RPAR {
 						count++
 					}
-					buffer = append(buffer, &ByteCode{cmdCall, objInfo})
+					bcall := newByteCode(cmdCall, objInfo, lexem)
+					calls[bcall] = &callInfo{Lexem: lexem, Contract: isContract}
+					buffer = append(buffer, bcall)
 					if isContract {
 						name := StateName((*block)[0].Info.(uint32), lexem.Value.(string))
 						for i := len(*block) - 1; i >= 0; i-- {
@@ -817,29 +966,44 @@ main:
 								topblock.Info.(*ContractInfo).Used[name] = true
 							}
 						}
-						bytecode = append(bytecode, &ByteCode{CMD_PUSH, name})
+						bytecode = append(bytecode, newByteCode(CMD_PUSH, name, lexem))
 						if count == 0 {
 							count = 2
-							bytecode = append(bytecode, &ByteCode{CMD_PUSH, ""})
-							bytecode = append(bytecode, &ByteCode{CMD_PUSH, ""})
+							bytecode = append(bytecode, newByteCode(CMD_PUSH, "", lexem))
+							bytecode = append(bytecode, newByteCode(CMD_PUSH, "", lexem))
 						}
 						count++
 					}
+					if flags := vm.TableFuncs[lexem.Value.(string)] & (TABLE_READ | TABLE_WRITE); flags != 0 &&
+						objInfo.Type == OBJ_EXTFUNC {
+						table := vm.tableName(lexems, i+2, (*block)[0].Info.(uint32))
+						for i := len(*block) - 1; i >= 0; i-- {
+							topblock := (*block)[i]
+							if topblock.Type == OBJ_CONTRACT {
+								if topblock.Info.(*ContractInfo).Tables == nil {
+									topblock.Info.(*ContractInfo).Tables = make(map[string]int)
+								}
+								topblock.Info.(*ContractInfo).Tables[table] |= flags
+							}
+						}
+					}
 					if lexem.Value.(string) == `CallContract` {
-						bytecode = append(bytecode, &ByteCode{CMD_PUSH, (*block)[0].Info.(uint32)})
+						bytecode = append(bytecode, newByteCode(CMD_PUSH, (*block)[0].Info.(uint32), lexem))
+						calls[bcall].Hidden = 1
 					}
 					parcount = append(parcount, count)
 					call = true
 				}
 				if (*lexems)[i+1].Type == IS_LBRACK {
 					if objInfo == nil || objInfo.Type != OBJ_VAR {
-						return fmt.Errorf(`unknown variable %s`, lexem.Value.(string))
+						return nil, unknownError(`variable`, lexem, vars != nil)
 					}
-					buffer = append(buffer, &ByteCode{CMD_INDEX, 0})
+					buffer = append(buffer, newByteCode(CMD_INDEX, 0, lexem))
 				}
 			}
 			if !call {
-				cmd = &ByteCode{CMD_VAR, &VarInfo{objInfo, tobj}}
+				cmd = newByteCode(CMD_VAR, &VarInfo{objInfo, tobj}, lexem)
+				delete(vars, objInfo)
 			}
 		}
 		if cmd != nil {
@@ -849,14 +1013,21 @@ main:
 	*ind = i
 	for i := len(buffer) - 1; i >= 0; i-- {
 		if buffer[i].Cmd == CMD_SYS {
-			return fmt.Errorf(`there is not pair`)
+			return nil, fmt.Errorf(`there is not pair`)
 		} else {
 			bytecode = append(bytecode, buffer[i])
 		}
 	}
-	if setIndex {
-		bytecode = append(bytecode, &ByteCode{CMD_SETINDEX, 0})
+	if setIndex != nil {
+		bytecode = append(bytecode, setIndex)
+	}
+	var types []TypeItem
+	if vars != nil {
+		var err error
+		if types, err = checkEval(bytecode, calls); err != nil {
+			return nil, err
+		}
 	}
 	curBlock.Code = append(curBlock.Code, bytecode...)
-	return nil
+	return types, nil
 }
@@ -18,6 +18,8 @@ package script
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -162,6 +164,41 @@ func TestVMCompile(t *testing.T) {
 							}
 						}
 						`, `mytest.init`, `OK`},
+		{`func forloop string {
+					var ret string
+					var my map
+					my["b"] = 2
+					my["a"] = 1
+					my["c"] = 3
+					for key, value in my {
+						ret = Sprintf("%s%s=%d;", ret, key, value)
+					}
+					for key in GetMap() {
+						ret = ret + key + ";"
+					}
+					for i, item in GetArray() {
+						if i == 0 {
+							continue
+						}
+						ret = Sprintf("%s%d:%v;", ret, i, item)
+						break
+					}
+					var list array
+					list[0] = 10
+					list[1] = 2000
+					for item in list {
+						if item == 2000 {
+							return ret + "found"
+						}
+					}
+					return "not found"
+				}`, `forloop`, `a=1;b=2;c=3;par0;par1;1:The second string;found`},
+		{`func forerr string {
+					var i int
+					for item in i {
+					}
+					return "OK"
+				}`, `forerr`, `Type int64 doesn't support for loop`},
 		{`func money_test string {
 					var my2, m1 money
 					my2 = 100
@@ -273,3 +310,435 @@ func TestVMCompile(t *testing.T) {
 	//fmt.Println(ret[0].(string))
 	//	fmt.Println(`Result`, err)
 }
+
+func TestVMForVars(t *testing.T) {
+	vm := NewVM()
+	for _, item := range []TestComp{
+		{`for key, value in list {`, ``},
+		{`for key value in list {`, `expecting comma between for variables [Ln:3 Col:14]`},
+		{`for , value in list {`, `unexpected comma in for [Ln:3 Col:10]`},
+		{`for key,, value in list {`, `unexpected comma in for [Ln:3 Col:14]`},
+		{`for key, in list {`, `for must have one or two variables [Ln:3 Col:15]`},
+	} {
+		var out string
+		_, err := vm.CompileBlock([]rune(`func check {
+				var list array
+				`+item.Input+`
+				}
+			}`), 0, true, 1)
+		if err != nil {
+			out = err.Error()
+		}
+		if out != item.Output {
+			t.Errorf(`wrong result %s instead of %s`, out, item.Output)
+		}
+	}
+}
+
+func TestVMCheck(t *testing.T) {
+	test := []TestComp{
+		{`func sum(a b int) int {
+				return a + b
+			}
+			func check string {
+				return Sprintf("%d", sum(1, 2, 3))
+			}`, `wrong number of parameters in sum (3 instead of 2) [Ln:5 Col:27]`},
+		{`func check string {
+				return Sprintf("%d", GetMap(10))
+			}`, `wrong number of parameters in GetMap (1 instead of 0) [Ln:2 Col:27]`},
+		{`func name(id int) string {
+				return Sprintf("%d", id)
+			}
+			func check string {
+				return name("id")
+			}`, `wrong type of parameter 1 in name (string instead of int) [Ln:5 Col:13]`},
+		{`func check string {
+				return Sprintf(10)
+			}`, `wrong type of parameter 1 in Sprintf (int instead of string) [Ln:2 Col:13]`},
+		{`func count int {
+				return 10
+			}
+			func check money {
+				var m money
+				m = count()
+				return m
+			}`, ``},
+		{`func valid bool {
+				return true
+			}
+			func check money {
+				var m money
+				m = valid()
+				return m
+			}`, `cannot assign bool to money variable [Ln:6 Col:8]`},
+		{`func check money {
+				var m money
+				m = 10 * 2
+				m = m + 1.5
+				return m
+			}`, ``},
+		{`func pair int, string {
+				return 1
+			}`, `wrong number of return values (1 instead of 2) [Ln:2 Col:6]`},
+		{`func pair int, string {
+				return 1, "one"
+			}
+			func check string {
+				var i int, s string
+				i, s = pair()
+				return Sprintf("%d %s", i, s)
+			}`, ``},
+		{`func check string {
+				var i int, s string
+				s = "test"
+				return s
+			}`, `variable i is declared but not used [Ln:2 Col:10]`},
+		{`func check string {
+				var s string
+				s = value
+				return s
+			}`, `unknown identifier value [Ln:3 Col:10]`},
+	}
+	vm := NewVM()
+	vm.Extend(&ExtendData{map[string]interface{}{"Sprintf": fmt.Sprintf, "GetMap": getMap}, nil})
+	for _, item := range test {
+		var out string
+		if err := vm.CheckBlock([]rune(item.Input), 0); err != nil {
+			out = err.Error()
+		}
+		if out != item.Output {
+			t.Errorf(`wrong check result %s of %s`, out, item.Input)
+		}
+	}
+	// the deployed contracts are compiled without these checks
+	if _, err := vm.CompileBlock([]rune(test[4].Input), 0, true, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVMCost(t *testing.T) {
+	vm := NewVM()
+	vm.Extend(&ExtendData{map[string]interface{}{"Sprintf": fmt.Sprintf}, nil})
+	if err := vm.Compile([]rune(`func loop(count int) int {
+				var i int
+				while i < count {
+					i = i + 1
+				}
+				return i
+			}
+			func concat(count int) string {
+				var s string
+				s = "0123456789012345678901234567890123456789"
+				while count > 0 {
+					s = s + s
+					count = count - 1
+				}
+				return s
+			}
+			func grow(count int) int {
+				var list array
+				list[count] = 1
+				return count
+			}`), 0, true, 1); err != nil {
+		t.Error(err)
+		return
+	}
+	runBlock := func(name string, count int64, cost int64, blockId int64) (int64, error) {
+		rt := vm.RunInit(cost)
+		rt.stack = append(rt.stack, count)
+		_, err := rt.Run(vm.getObjByName(name).Value.(*Block), nil, &map[string]interface{}{`block`: blockId})
+		return cost - rt.Cost(), err
+	}
+	run := func(name string, count int64, cost int64) (int64, error) {
+		return runBlock(name, count, cost, 0)
+	}
+	// the cost of the loop must grow with the count of iterations
+	used10, err := run(`loop`, 10, COST_DEFAULT)
+	if err != nil {
+		t.Error(err)
+	}
+	used20, err := run(`loop`, 20, COST_DEFAULT)
+	if err != nil {
+		t.Error(err)
+	}
+	if used20 <= used10 || used20-used10 < 10*(CmdCost[CMD_ADD]+CmdCost[CMD_LESS]) {
+		t.Errorf(`wrong cost of loop %d %d`, used10, used20)
+	}
+	if _, err = run(`loop`, 1000, 500); err == nil || err.Error() != `paid CPU resource is over` {
+		t.Errorf(`cost of loop must be over %v`, err)
+	}
+	// the concatenation of long strings costs more than the same count of short ones
+	used4, _ := run(`concat`, 4, COST_DEFAULT)
+	used8, _ := run(`concat`, 8, COST_DEFAULT)
+	if used8-used4 < 40*(1<<8-1<<4)/COST_STRLEN {
+		t.Errorf(`wrong cost of concatenation %d %d`, used4, used8)
+	}
+	// the growth of array must be checked before the allocation
+	if _, err = run(`grow`, 1<<40, 10000); err == nil || err.Error() != `paid CPU resource is over` {
+		t.Errorf(`cost of array growth must be over %v`, err)
+	}
+	if _, err = run(`grow`, math.MaxInt64, COST_DEFAULT); err == nil || err.Error() != `paid CPU resource is over` {
+		t.Errorf(`cost of array growth must not overflow %v`, err)
+	}
+	// the blocks before COST_BLOCK are charged one unit per command
+	old10, err := runBlock(`loop`, 10, COST_DEFAULT, COST_BLOCK-1)
+	if err != nil {
+		t.Error(err)
+	}
+	old20, _ := runBlock(`loop`, 20, COST_DEFAULT, COST_BLOCK-1)
+	if old20-old10 >= used20-used10 {
+		t.Errorf(`wrong cost of loop before COST_BLOCK %d %d`, old10, old20)
+	}
+	if new10, _ := runBlock(`loop`, 10, COST_DEFAULT, COST_BLOCK); new10 != used10 {
+		t.Errorf(`wrong cost of loop since COST_BLOCK %d %d`, new10, used10)
+	}
+	old4, _ := runBlock(`concat`, 4, COST_DEFAULT, 1)
+	old8, _ := runBlock(`concat`, 8, COST_DEFAULT, 1)
+	if old8-old4 >= used8-used4 {
+		t.Errorf(`wrong cost of concatenation before COST_BLOCK %d %d`, old4, old8)
+	}
+}
+
+func TestVMDebug(t *testing.T) {
+	vm := NewVM()
+	vm.Extend(&ExtendData{map[string]interface{}{"Sprintf": fmt.Sprintf}, nil})
+	if err := vm.Compile([]rune(`func sum(count int) string {
+				var i, total int
+				while i < count {
+					i = i + 1
+					total = total + i
+				}
+				return Sprintf("%d", total)
+			}`), 0, true, 1); err != nil {
+		t.Error(err)
+		return
+	}
+	block := vm.getObjByName(`sum`).Value.(*Block)
+	code := Disassemble(block)
+	for _, line := range []string{"func sum(int) string\n", "\tvar total int\n", "\t0004 [3:6] WHILE\n",
+		"\t\t0000 [4:7] ASSIGNVAR i\n", "\t0008 [7:13] CALLVARI Sprintf\n"} {
+		if !strings.Contains(code, line) {
+			t.Errorf(`disassembled code doesn't contain %q`, line)
+		}
+	}
+	run := func(dbg *Debugger) ([]interface{}, error) {
+		rt := vm.RunInit(COST_DEFAULT)
+		rt.SetDebugger(dbg)
+		rt.stack = append(rt.stack, int64(3))
+		return rt.Run(block, nil, &map[string]interface{}{})
+	}
+	var totals []interface{}
+	ret, err := run(&Debugger{Breakpoints: map[uint32]bool{5: true}, OnBreak: func(state *DebugState) int {
+		totals = append(totals, state.Vars[`total`])
+		return DEBUG_CONTINUE
+	}})
+	if err != nil {
+		t.Error(err)
+	} else if fmt.Sprint(ret, totals) != `[6] [0 1 3]` {
+		t.Errorf(`wrong breakpoints %v %v`, ret, totals)
+	}
+	var lines []uint32
+	_, err = run(&Debugger{Step: true, OnBreak: func(state *DebugState) int {
+		lines = append(lines, state.Line)
+		if len(lines) == 4 {
+			return DEBUG_STOP
+		}
+		return DEBUG_STEP
+	}})
+	if err == nil || err.Error() != `execution has been stopped by debugger [Ln:6 Col:6]` {
+		t.Errorf(`wrong stop error %v`, err)
+	}
+	if fmt.Sprint(lines) != `[3 4 5 6]` {
+		t.Errorf(`wrong steps %v`, lines)
+	}
+	if err := vm.Compile([]rune(`func loop(count int) int {
+				var i int
+				while i < count { i = i + 1 }
+				return i
+			}`), 0, true, 1); err != nil {
+		t.Error(err)
+		return
+	}
+	block = vm.getObjByName(`loop`).Value.(*Block)
+	var stops int
+	if _, err = run(&Debugger{Breakpoints: map[uint32]bool{3: true}, OnBreak: func(state *DebugState) int {
+		stops++
+		return DEBUG_CONTINUE
+	}}); err != nil {
+		t.Error(err)
+	} else if stops != 7 {
+		// 4 checks of the condition and 3 iterations of the loop
+		t.Errorf(`wrong stops in one line loop %d`, stops)
+	}
+}
+
+func TestVMEncode(t *testing.T) {
+	vm := NewVM()
+	vm.Extend(&ExtendData{map[string]interface{}{"Sprintf": fmt.Sprintf}, nil})
+	if err := vm.Compile([]rune(`func double(val int) int {
+				return val * 2
+			}`), 0, true, 1); err != nil {
+		t.Error(err)
+		return
+	}
+	root, err := vm.CompileBlock([]rune(`func sum(count int) string {
+				var i, total int
+				var list array
+				var ret string
+				while i < count {
+					i = i + 1
+					list[i] = double(i)
+				}
+				for ind, item in list {
+					if ind > 1 {
+						total = total + ind
+						ret = ret + Sprintf("%v;", item)
+					}
+				}
+				return Sprintf("%d %s", total, ret)
+			}
+			contract my {
+				data {
+					Name string "optional"
+				}
+				func action {
+					$result = Sprintf("%s %v", $Name, sum(3))
+				}
+			}`), 1, true, 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := vm.EncodeBlock(root)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	block, err := vm.DecodeBlock(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if Disassemble(root) != Disassemble(block) {
+		t.Errorf("different code\n%s\n%s", Disassemble(root), Disassemble(block))
+	}
+	if _, err = vm.DecodeBlock(data[:len(data)-1]); err == nil {
+		t.Error(`truncated code has been decoded`)
+	}
+	rt := vm.RunInit(COST_DEFAULT)
+	rt.stack = append(rt.stack, int64(3))
+	ret, err := rt.Run(block.Objects[`sum`].Value.(*Block), nil, &map[string]interface{}{})
+	if err != nil {
+		t.Error(err)
+	} else if fmt.Sprint(ret) != `[5 4;6;]` {
+		t.Errorf(`wrong result %v`, ret)
+	}
+}
+
+func TestVMCallContract(t *testing.T) {
+	vm := NewVM()
+	vm.Extend(&ExtendData{map[string]interface{}{"Sprintf": fmt.Sprintf}, nil})
+	if err := vm.Compile([]rune(`contract callee {
+				data {
+					Amount int
+					Comment string "optional"
+				}
+				conditions {
+					if $Amount <= 0 {
+						error "wrong amount"
+					}
+				}
+				action {
+					$result = Sprintf("%d:%s", $Amount, $Comment)
+				}
+			}
+			contract caller {
+				action {
+					var pars map
+					pars["Amount"] = $Value
+					$ret = CallContract("callee", pars)
+					$ret = Sprintf("%v %d %v", $ret, $Amount, $result)
+				}
+			}
+			contract direct {
+				action {
+					callee("Amount,Comment", $Value, "direct")
+					$ret = Sprintf("%d %v", $Amount, $Comment)
+				}
+			}`), 1, true, 1); err != nil {
+		t.Error(err)
+		return
+	}
+	block := vm.Objects[`@1caller`].Value.(*Block).Objects[`action`].Value.(*Block)
+	for _, item := range []struct {
+		Value int64
+		Want  string
+	}{{7, `7: 3 caller`}, {0, `wrong amount`}} {
+		extend := map[string]interface{}{`Value`: item.Value, `Amount`: int64(3), `result`: `caller`}
+		_, err := vm.RunInit(COST_DEFAULT).Run(block, nil, &extend)
+		out := fmt.Sprint(extend[`ret`])
+		if err != nil {
+			out = err.Error()
+		}
+		if out != item.Want {
+			t.Errorf(`wrong result %s instead of %s`, out, item.Want)
+		}
+	}
+	// the contract called directly leaves its parameters to the caller
+	block = vm.Objects[`@1direct`].Value.(*Block).Objects[`action`].Value.(*Block)
+	extend := map[string]interface{}{`Value`: int64(7), `Amount`: int64(3)}
+	if _, err := vm.RunInit(COST_DEFAULT).Run(block, nil, &extend); err != nil {
+		t.Error(err)
+	} else if out := fmt.Sprint(extend[`ret`]); out != `7 direct` {
+		t.Errorf(`wrong result %s instead of 7 direct`, out)
+	}
+}
+
+func TestVMTables(t *testing.T) {
+	vm := NewVM()
+	vm.Extend(&ExtendData{map[string]interface{}{
+		"DBInsert": func(table string, columns string, values ...interface{}) int64 { return 0 },
+		"DBString": func(table, column string, id int64) string { return `` },
+		"Table":    func(name string) string { return name },
+		"TableTx":  func(name string) string { return name },
+	}, nil})
+	vm.ExtendTables(map[string]int{"DBInsert": TABLE_WRITE, "DBString": TABLE_READ, "Table": TABLE_PREFIX,
+		"TableTx": TABLE_PREFIX | TABLE_ANY})
+	root, err := vm.CompileBlock([]rune(`contract log {
+				func action {
+					DBInsert("global_log", "name", "test")
+				}
+			}
+			contract my {
+				func action {
+					var name string
+					name = DBString(Table("accounts"), "name", 1)
+					DBInsert(Table("accounts"), "name", name)
+					DBInsert(name + "_log", "name", name)
+					DBInsert(TableTx("citizens"), "name", name)
+					log()
+				}
+			}`), 1, true, 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := vm.EncodeBlock(root)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	block, err := vm.DecodeBlock(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, item := range []*Block{root, block} {
+		if out := fmt.Sprint(item.Objects[`@1my`].Value.(*Block).Info.(*ContractInfo).Tables); out != `map[*:2 *_citizens:2 1_accounts:3]` {
+			t.Errorf(`wrong tables %s`, out)
+		}
+		if out := fmt.Sprint(item.Objects[`@1log`].Value.(*Block).Info.(*ContractInfo).Tables); out != `map[global_log:2]` {
+			t.Errorf(`wrong tables %s`, out)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	DEBUG_CONTINUE = iota // run to the next breakpoint
+	DEBUG_STEP            // stop at the next line
+	DEBUG_STOP            // stop the execution with the error
+)
+
+var (
+	cmdNames = map[uint16]string{CMD_UNKNOWN: `UNKNOWN`, CMD_PUSH: `PUSH`, CMD_VAR: `VAR`, CMD_EXTEND: `EXTEND`,
+		CMD_CALLEXTEND: `CALLEXTEND`, CMD_PUSHSTR: `PUSHSTR`, CMD_TABLE: `TABLE`, CMD_CALL: `CALL`,
+		CMD_CALLVARI: `CALLVARI`, CMD_RETURN: `RETURN`, CMD_IF: `IF`, CMD_ELSE: `ELSE`, CMD_ASSIGNVAR: `ASSIGNVAR`,
+		CMD_ASSIGN: `ASSIGN`, CMD_LABEL: `LABEL`, CMD_CONTINUE: `CONTINUE`, CMD_WHILE: `WHILE`, CMD_BREAK: `BREAK`,
+		CMD_INDEX: `INDEX`, CMD_SETINDEX: `SETINDEX`, CMD_ERROR: `ERROR`, CMD_FOR: `FOR`, CMD_NOT: `NOT`,
+		CMD_SIGN: `SIGN`, CMD_ADD: `ADD`, CMD_SUB: `SUB`, CMD_MUL: `MUL`, CMD_DIV: `DIV`, CMD_AND: `AND`,
+		CMD_OR: `OR`, CMD_EQUAL: `EQUAL`, CMD_NOTEQ: `NOTEQ`, CMD_LESS: `LESS`, CMD_NOTLESS: `NOTLESS`,
+		CMD_GREAT: `GREAT`, CMD_NOTGREAT: `NOTGREAT`}
+)
+
+// DebugState is the state of the runtime at the stop of the debugger
+type DebugState struct {
+	Line   uint32                 // Line of the source code
+	Column uint32                 // Position inside the line
+	Cmd    string                 // The name of the next command
+	Stack  []interface{}          // The copy of the stack
+	Vars   map[string]interface{} // The values of variables which are visible in the current block
+	Extend map[string]interface{} // The extend values ($name)
+}
+
+// Debugger is used for the step-by-step execution of the contracts.
+// OnBreak is called at each stop and returns DEBUG_CONTINUE, DEBUG_STEP or DEBUG_STOP.
+type Debugger struct {
+	Breakpoints map[uint32]bool // lines of the source code
+	Step        bool            // stop at the next line
+	OnBreak     func(*DebugState) int
+}
+
+// CmdName returns the name of the bytecode command
+func CmdName(cmd uint16) string {
+	if name, ok := cmdNames[cmd]; ok {
+		return name
+	}
+	return fmt.Sprintf(`CMD_%d`, cmd)
+}
+
+// SetDebugger turns on the debugging mode of the runtime
+func (rt *RunTime) SetDebugger(debugger *Debugger) {
+	rt.debug = debugger
+}
+
+// debugCmd is called before the execution of each command in the debugging mode. The debugger stops
+// at the first command of the line in the block, so the line is stopped at every iteration of the loop
+// even if the whole loop is in one line.
+func (rt *RunTime) debugCmd(block *Block, ci int) error {
+	dbg := rt.debug
+	cmd := block.Code[ci]
+	if cmd.Line == 0 || (ci > 0 && block.Code[ci-1].Line == cmd.Line) {
+		return nil
+	}
+	if (!dbg.Step && !dbg.Breakpoints[cmd.Line]) || dbg.OnBreak == nil {
+		return nil
+	}
+	state := DebugState{Line: cmd.Line, Column: cmd.Column, Cmd: CmdName(cmd.Cmd),
+		Stack: make([]interface{}, len(rt.stack)), Vars: rt.blockVars(block)}
+	copy(state.Stack, rt.stack)
+	if rt.extend != nil {
+		state.Extend = *rt.extend
+	}
+	switch dbg.OnBreak(&state) {
+	case DEBUG_STEP:
+		dbg.Step = true
+	case DEBUG_STOP:
+		return fmt.Errorf(`execution has been stopped by debugger [Ln:%d Col:%d]`, cmd.Line, cmd.Column)
+	default:
+		dbg.Step = false
+	}
+	return nil
+}
+
+// blockVars returns the values of variables of the block and its parents
+func (rt *RunTime) blockVars(block *Block) map[string]interface{} {
+	ret := make(map[string]interface{})
+	for ; block != nil; block = block.Parent {
+		for i := len(rt.blocks) - 1; i >= 0; i-- {
+			if rt.blocks[i].Block != block {
+				continue
+			}
+			for name, obj := range block.Objects {
+				if _, ok := ret[name]; !ok && obj.Type == OBJ_VAR {
+					ret[name] = rt.vars[rt.blocks[i].Offset+obj.Value.(int)]
+				}
+			}
+			break
+		}
+	}
+	return ret
+}
+
+// objName returns the name of the object in the parent block
+func objName(parent *Block, value interface{}) string {
+	if parent != nil {
+		for name, obj := range parent.Objects {
+			if obj.Value == value {
+				return name
+			}
+		}
+	}
+	return `?`
+}
+
+// varNames returns the names of variables of the block in the order of declaration
+func varNames(block *Block) []string {
+	names := make([]string, len(block.Vars))
+	for name, obj := range block.Objects {
+		if obj.Type == OBJ_VAR && obj.Value.(int) < len(names) {
+			names[obj.Value.(int)] = name
+		}
+	}
+	return names
+}
+
+func typeNames(types []reflect.Type) string {
+	ret := make([]string, 0, len(types))
+	for _, item := range types {
+		ret = append(ret, typeName(item))
+	}
+	return strings.Join(ret, `, `)
+}
+
+// cmdValue returns the text representation of the parameter of the command
+func cmdValue(cmd *ByteCode) string {
+	switch value := cmd.Value.(type) {
+	case *ObjInfo:
+		if value.Type == OBJ_EXTFUNC {
+			return value.Value.(ExtFuncInfo).Name
+		}
+		if block, ok := value.Value.(*Block); ok {
+			return objName(block.Parent, block)
+		}
+	case *VarInfo:
+		if value.Owner == nil {
+			return fmt.Sprintf(`$%v`, value.Obj.Value)
+		}
+		for name, obj := range value.Owner.Objects {
+			if obj == value.Obj {
+				return name
+			}
+		}
+	case []*VarInfo:
+		names := make([]string, len(value))
+		for i, item := range value {
+			names[i] = cmdValue(&ByteCode{Value: item})
+		}
+		return strings.Join(names, `, `)
+	case string:
+		if cmd.Cmd == CMD_EXTEND || cmd.Cmd == CMD_CALLEXTEND {
+			return `$` + value
+		}
+		return fmt.Sprintf(`%q`, value)
+	case uint32:
+		if cmd.Cmd == CMD_ERROR {
+			for name, key := range KEYWORDS {
+				if key == value {
+					return name
+				}
+			}
+		}
+	}
+	if cmd.Cmd == CMD_PUSH {
+		return fmt.Sprintf(`%v`, cmd.Value)
+	}
+	return ``
+}
+
+func disasmCode(out *bytes.Buffer, block *Block, indent string) {
+	for i, name := range varNames(block) {
+		fmt.Fprintf(out, "%svar %s %s\n", indent, name, typeName(block.Vars[i]))
+	}
+	for i, cmd := range block.Code {
+		line := fmt.Sprintf(`%s%04d [%d:%d] %s`, indent, i, cmd.Line, cmd.Column, CmdName(cmd.Cmd))
+		if value := cmdValue(cmd); len(value) > 0 {
+			line += ` ` + value
+		}
+		fmt.Fprintln(out, line)
+		if child, ok := cmd.Value.(*Block); ok {
+			disasmCode(out, child, indent+"\t")
+		}
+	}
+}
+
+func disasmBlock(out *bytes.Buffer, block *Block, indent string) {
+	inner := indent
+	switch block.Type {
+	case OBJ_CONTRACT:
+		info := block.Info.(*ContractInfo)
+		fmt.Fprintf(out, "%scontract %s\n", indent, info.Name)
+		inner += "\t"
+		if info.Tx != nil {
+			for _, field := range *info.Tx {
+				fmt.Fprintln(out, strings.TrimRight(fmt.Sprintf("%sdata %s %s %s", inner, field.Name,
+					typeName(field.Type), field.Tags), ` `))
+			}
+		}
+	case OBJ_FUNC:
+		info := block.Info.(*FuncInfo)
+		fmt.Fprintln(out, strings.TrimRight(fmt.Sprintf("%sfunc %s(%s) %s", indent, objName(block.Parent, block),
+			typeNames(info.Params), typeNames(info.Results)), ` `))
+		inner += "\t"
+	}
+	disasmCode(out, block, inner)
+	children := make([]*Block, 0, len(block.Children))
+	for _, child := range block.Children {
+		if child != nil && (child.Type == OBJ_CONTRACT || child.Type == OBJ_FUNC) {
+			children = append(children, child)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return len(children[i].Code) > 0 && len(children[j].Code) > 0 &&
+			children[i].Code[0].Line < children[j].Code[0].Line
+	})
+	for _, child := range children {
+		disasmBlock(out, child, inner)
+	}
+}
+
+// Disassemble returns the text representation of the bytecode of the block and all its children
+func Disassemble(block *Block) string {
+	var out bytes.Buffer
+	disasmBlock(&out, block, ``)
+	return out.String()
+}
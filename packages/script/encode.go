@@ -0,0 +1,546 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package script
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// CODE_VERSION is the version of the binary format of the compiled code.
+// It must be increased when the format or the bytecode commands are changed.
+const CODE_VERSION = 2
+
+// Tags of the values in the binary format
+const (
+	enc_NIL = iota
+	enc_INT
+	enc_INT64
+	enc_UINT16
+	enc_UINT32
+	enc_FLOAT
+	enc_STRING
+	enc_BLOCK
+	enc_OBJECT
+	enc_VAR
+	enc_VARS
+	enc_STATE    // Info of the root block
+	enc_CONTRACT // Info of the contract
+	enc_FUNC     // Info of the function
+	enc_FOR      // Info of the for loop
+	enc_EXTERN   // the object is defined outside of the encoded tree
+)
+
+var typeInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+
+type encoder struct {
+	vm     *VM
+	buf    bytes.Buffer
+	blocks map[*Block]int
+	names  map[*Block]string // the names of functions and contracts of VM
+}
+
+type decoder struct {
+	vm     *VM
+	buf    *bytes.Reader
+	blocks []*Block
+	err    error
+}
+
+// EncodeBlock returns the binary representation of the block which has been compiled by CompileBlock.
+// The objects which are not defined in the block are stored by names and must exist in VM at decoding.
+func (vm *VM) EncodeBlock(root *Block) (data []byte, err error) {
+	enc := encoder{vm: vm, blocks: make(map[*Block]int)}
+	list := make([]*Block, 0, 32)
+	var walk func(*Block)
+	walk = func(block *Block) {
+		enc.blocks[block] = len(list)
+		list = append(list, block)
+		for _, child := range block.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf(`%v`, r)
+		}
+	}()
+	enc.uint(CODE_VERSION)
+	enc.uint(uint64(len(list)))
+	for i, block := range list {
+		if i > 0 {
+			enc.uint(uint64(enc.blocks[block.Parent]))
+		}
+		enc.uint(uint64(block.Type))
+		enc.bool(block.Active)
+		enc.int(block.TblId)
+		enc.info(block.Info)
+		enc.types(block.Vars)
+		names := make([]string, 0, len(block.Objects))
+		for name := range block.Objects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		enc.uint(uint64(len(names)))
+		for _, name := range names {
+			obj := block.Objects[name]
+			enc.string(name)
+			enc.uint(uint64(obj.Type))
+			enc.value(obj.Value)
+		}
+	}
+	// the code is stored after all blocks because it refers to the objects of the blocks
+	for _, block := range list {
+		enc.uint(uint64(len(block.Code)))
+		for _, cmd := range block.Code {
+			enc.uint(uint64(cmd.Cmd))
+			enc.uint(uint64(cmd.Line))
+			enc.uint(uint64(cmd.Column))
+			enc.value(cmd.Value)
+		}
+	}
+	return enc.buf.Bytes(), nil
+}
+
+func (enc *encoder) uint(value uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	enc.buf.Write(buf[:binary.PutUvarint(buf[:], value)])
+}
+
+func (enc *encoder) int(value int64) {
+	var buf [binary.MaxVarintLen64]byte
+	enc.buf.Write(buf[:binary.PutVarint(buf[:], value)])
+}
+
+func (enc *encoder) bool(value bool) {
+	if value {
+		enc.buf.WriteByte(1)
+	} else {
+		enc.buf.WriteByte(0)
+	}
+}
+
+func (enc *encoder) string(value string) {
+	enc.uint(uint64(len(value)))
+	enc.buf.WriteString(value)
+}
+
+func (enc *encoder) typ(value reflect.Type) {
+	switch value {
+	case nil:
+		enc.string(``)
+	case typeInterface:
+		enc.string(`interface`)
+	default:
+		name := typeName(value)
+		if _, ok := TYPES[name]; !ok {
+			panic(fmt.Sprintf(`unsupported type %s`, name))
+		}
+		enc.string(name)
+	}
+}
+
+func (enc *encoder) types(list []reflect.Type) {
+	enc.uint(uint64(len(list)))
+	for _, item := range list {
+		enc.typ(item)
+	}
+}
+
+// external returns the name of the function or the contract which has been defined in VM
+func (enc *encoder) external(block *Block) string {
+	if enc.names == nil {
+		enc.names = make(map[*Block]string)
+		for name, obj := range enc.vm.Objects {
+			if item, ok := obj.Value.(*Block); ok {
+				enc.names[item] = name
+			}
+		}
+	}
+	if name, ok := enc.names[block]; ok {
+		return name
+	}
+	panic(`unknown external block`)
+}
+
+func (enc *encoder) block(block *Block) {
+	if ind, ok := enc.blocks[block]; ok {
+		enc.buf.WriteByte(enc_BLOCK)
+		enc.uint(uint64(ind))
+	} else {
+		enc.buf.WriteByte(enc_EXTERN)
+		enc.string(enc.external(block))
+	}
+}
+
+func (enc *encoder) info(info interface{}) {
+	switch value := info.(type) {
+	case nil:
+		enc.buf.WriteByte(enc_NIL)
+	case uint32:
+		enc.buf.WriteByte(enc_STATE)
+		enc.uint(uint64(value))
+	case *ContractInfo:
+		enc.buf.WriteByte(enc_CONTRACT)
+		enc.uint(uint64(value.Id))
+		enc.string(value.Name)
+		enc.bool(value.Active)
+		enc.int(value.TblId)
+		used := make([]string, 0, len(value.Used))
+		for name := range value.Used {
+			used = append(used, name)
+		}
+		sort.Strings(used)
+		enc.uint(uint64(len(used)))
+		for _, name := range used {
+			enc.string(name)
+		}
+		tables := make([]string, 0, len(value.Tables))
+		for name := range value.Tables {
+			tables = append(tables, name)
+		}
+		sort.Strings(tables)
+		enc.uint(uint64(len(tables)))
+		for _, name := range tables {
+			enc.string(name)
+			enc.uint(uint64(value.Tables[name]))
+		}
+		enc.bool(value.Tx != nil)
+		if value.Tx != nil {
+			enc.uint(uint64(len(*value.Tx)))
+			for _, field := range *value.Tx {
+				enc.string(field.Name)
+				enc.typ(field.Type)
+				enc.string(field.Tags)
+			}
+		}
+	case *FuncInfo:
+		enc.buf.WriteByte(enc_FUNC)
+		enc.types(value.Params)
+		enc.types(value.Results)
+		enc.bool(value.Variadic)
+	case *ForInfo:
+		enc.buf.WriteByte(enc_FOR)
+		enc.uint(uint64(value.Vars))
+	default:
+		panic(fmt.Sprintf(`unsupported block info %T`, info))
+	}
+}
+
+func (enc *encoder) varInfo(value *VarInfo) {
+	if value.Owner == nil {
+		// $name variable
+		enc.bool(false)
+		enc.string(value.Obj.Value.(string))
+		return
+	}
+	enc.bool(true)
+	enc.uint(uint64(enc.blocks[value.Owner]))
+	enc.uint(uint64(value.Obj.Value.(int)))
+}
+
+func (enc *encoder) value(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		enc.buf.WriteByte(enc_NIL)
+	case int:
+		enc.buf.WriteByte(enc_INT)
+		enc.int(int64(v))
+	case int64:
+		enc.buf.WriteByte(enc_INT64)
+		enc.int(v)
+	case uint16:
+		enc.buf.WriteByte(enc_UINT16)
+		enc.uint(uint64(v))
+	case uint32:
+		enc.buf.WriteByte(enc_UINT32)
+		enc.uint(uint64(v))
+	case float64:
+		enc.buf.WriteByte(enc_FLOAT)
+		enc.uint(math.Float64bits(v))
+	case string:
+		enc.buf.WriteByte(enc_STRING)
+		enc.string(v)
+	case *Block:
+		enc.block(v)
+	case *ObjInfo:
+		enc.buf.WriteByte(enc_OBJECT)
+		enc.uint(uint64(v.Type))
+		if v.Type == OBJ_EXTFUNC {
+			enc.string(v.Value.(ExtFuncInfo).Name)
+		} else {
+			enc.value(v.Value)
+		}
+	case *VarInfo:
+		enc.buf.WriteByte(enc_VAR)
+		enc.varInfo(v)
+	case []*VarInfo:
+		enc.buf.WriteByte(enc_VARS)
+		enc.uint(uint64(len(v)))
+		for _, item := range v {
+			enc.varInfo(item)
+		}
+	default:
+		panic(fmt.Sprintf(`unsupported value %T`, value))
+	}
+}
+
+// DecodeBlock restores the block which has been encoded by EncodeBlock
+func (vm *VM) DecodeBlock(data []byte) (*Block, error) {
+	dec := decoder{vm: vm, buf: bytes.NewReader(data)}
+	if version := dec.uint(); version != CODE_VERSION {
+		return nil, fmt.Errorf(`unsupported version of code %d`, version)
+	}
+	count := dec.uint()
+	if dec.err != nil || count == 0 || count > uint64(len(data)) {
+		return nil, fmt.Errorf(`wrong count of blocks`)
+	}
+	dec.blocks = make([]*Block, count)
+	for i := range dec.blocks {
+		dec.blocks[i] = &Block{}
+	}
+	for i, block := range dec.blocks {
+		if i > 0 {
+			parent := dec.uint()
+			if parent >= uint64(i) {
+				return nil, fmt.Errorf(`wrong parent block %d`, parent)
+			}
+			block.Parent = dec.blocks[parent]
+			block.Parent.Children = append(block.Parent.Children, block)
+		}
+		block.Type = int(dec.uint())
+		block.Active = dec.bool()
+		block.TblId = dec.int()
+		block.Info = dec.info()
+		block.Vars = dec.types()
+		if objects := dec.uint(); objects > 0 && dec.err == nil {
+			block.Objects = make(map[string]*ObjInfo)
+			for j := uint64(0); j < objects && dec.err == nil; j++ {
+				name := dec.string()
+				obj := &ObjInfo{Type: int(dec.uint())}
+				obj.Value = dec.value()
+				block.Objects[name] = obj
+			}
+		}
+		if dec.err != nil {
+			return nil, dec.err
+		}
+	}
+	for _, block := range dec.blocks {
+		count := dec.uint()
+		for j := uint64(0); j < count && dec.err == nil; j++ {
+			cmd := &ByteCode{Cmd: uint16(dec.uint()), Line: uint32(dec.uint()), Column: uint32(dec.uint())}
+			cmd.Value = dec.value()
+			block.Code = append(block.Code, cmd)
+		}
+		if dec.err != nil {
+			return nil, dec.err
+		}
+	}
+	if dec.buf.Len() > 0 {
+		return nil, fmt.Errorf(`unexpected data at the end of code`)
+	}
+	return dec.blocks[0], nil
+}
+
+func (dec *decoder) fail(format string, params ...interface{}) {
+	if dec.err == nil {
+		dec.err = fmt.Errorf(format, params...)
+	}
+}
+
+func (dec *decoder) uint() uint64 {
+	value, err := binary.ReadUvarint(dec.buf)
+	if err != nil {
+		dec.fail(`wrong code: %v`, err)
+	}
+	return value
+}
+
+func (dec *decoder) int() int64 {
+	value, err := binary.ReadVarint(dec.buf)
+	if err != nil {
+		dec.fail(`wrong code: %v`, err)
+	}
+	return value
+}
+
+func (dec *decoder) byte() byte {
+	value, err := dec.buf.ReadByte()
+	if err != nil {
+		dec.fail(`wrong code: %v`, err)
+	}
+	return value
+}
+
+func (dec *decoder) bool() bool {
+	return dec.byte() != 0
+}
+
+func (dec *decoder) string() string {
+	size := dec.uint()
+	if dec.err != nil || size > uint64(dec.buf.Len()) {
+		dec.fail(`wrong length of string`)
+		return ``
+	}
+	value := make([]byte, size)
+	dec.buf.Read(value)
+	return string(value)
+}
+
+func (dec *decoder) typ() reflect.Type {
+	name := dec.string()
+	switch name {
+	case ``:
+		return nil
+	case `interface`:
+		return typeInterface
+	}
+	if itype, ok := TYPES[name]; ok {
+		return itype
+	}
+	dec.fail(`unknown type %s`, name)
+	return nil
+}
+
+func (dec *decoder) types() (list []reflect.Type) {
+	count := dec.uint()
+	for i := uint64(0); i < count && dec.err == nil; i++ {
+		list = append(list, dec.typ())
+	}
+	return
+}
+
+func (dec *decoder) block(ind uint64) *Block {
+	if ind >= uint64(len(dec.blocks)) {
+		dec.fail(`wrong block %d`, ind)
+		return nil
+	}
+	return dec.blocks[ind]
+}
+
+// external returns the object which has been defined in VM
+func (dec *decoder) external(name string, itype int) *ObjInfo {
+	obj, ok := dec.vm.Objects[name]
+	if !ok || obj.Type != itype {
+		dec.fail(`unknown object %s`, name)
+		return nil
+	}
+	return obj
+}
+
+func (dec *decoder) info() interface{} {
+	switch tag := dec.byte(); tag {
+	case enc_NIL:
+	case enc_STATE:
+		return uint32(dec.uint())
+	case enc_CONTRACT:
+		info := &ContractInfo{Id: uint32(dec.uint()), Name: dec.string(), Active: dec.bool(), TblId: dec.int()}
+		if used := dec.uint(); used > 0 && dec.err == nil {
+			info.Used = make(map[string]bool)
+			for i := uint64(0); i < used && dec.err == nil; i++ {
+				info.Used[dec.string()] = true
+			}
+		}
+		if tables := dec.uint(); tables > 0 && dec.err == nil {
+			info.Tables = make(map[string]int)
+			for i := uint64(0); i < tables && dec.err == nil; i++ {
+				info.Tables[dec.string()] = int(dec.uint())
+			}
+		}
+		if dec.bool() {
+			count := dec.uint()
+			fields := make([]*FieldInfo, 0)
+			for i := uint64(0); i < count && dec.err == nil; i++ {
+				fields = append(fields, &FieldInfo{Name: dec.string(), Type: dec.typ(), Tags: dec.string()})
+			}
+			info.Tx = &fields
+		}
+		return info
+	case enc_FUNC:
+		return &FuncInfo{Params: dec.types(), Results: dec.types(), Variadic: dec.bool()}
+	case enc_FOR:
+		return &ForInfo{Vars: int(dec.uint())}
+	default:
+		dec.fail(`unknown block info %d`, tag)
+	}
+	return nil
+}
+
+func (dec *decoder) varInfo() *VarInfo {
+	if !dec.bool() {
+		return &VarInfo{Obj: &ObjInfo{Type: OBJ_EXTEND, Value: dec.string()}}
+	}
+	owner := dec.block(dec.uint())
+	ind := int(dec.uint())
+	if owner != nil {
+		for _, obj := range owner.Objects {
+			if obj.Type == OBJ_VAR && obj.Value.(int) == ind {
+				return &VarInfo{Obj: obj, Owner: owner}
+			}
+		}
+	}
+	dec.fail(`unknown variable %d`, ind)
+	return nil
+}
+
+func (dec *decoder) value() interface{} {
+	switch tag := dec.byte(); tag {
+	case enc_NIL:
+	case enc_INT:
+		return int(dec.int())
+	case enc_INT64:
+		return dec.int()
+	case enc_UINT16:
+		return uint16(dec.uint())
+	case enc_UINT32:
+		return uint32(dec.uint())
+	case enc_FLOAT:
+		return math.Float64frombits(dec.uint())
+	case enc_STRING:
+		return dec.string()
+	case enc_BLOCK:
+		return dec.block(dec.uint())
+	case enc_EXTERN:
+		if obj := dec.external(dec.string(), OBJ_FUNC); obj != nil {
+			return obj.Value
+		}
+	case enc_OBJECT:
+		itype := int(dec.uint())
+		if itype == OBJ_EXTFUNC {
+			return dec.external(dec.string(), OBJ_EXTFUNC)
+		}
+		return &ObjInfo{Type: itype, Value: dec.value()}
+	case enc_VAR:
+		return dec.varInfo()
+	case enc_VARS:
+		count := dec.uint()
+		vars := make([]*VarInfo, 0)
+		for i := uint64(0); i < count && dec.err == nil; i++ {
+			vars = append(vars, dec.varInfo())
+		}
+		return vars
+	default:
+		dec.fail(`unknown value %d`, tag)
+	}
+	return nil
+}
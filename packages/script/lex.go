@@ -93,12 +93,14 @@ const (
 	KEY_ACTION
 	KEY_COND
 	KEY_ERROR
+	KEY_FOR
+	KEY_IN
 )
 
 var (
 	KEYWORDS = map[string]uint32{`contract`: KEY_CONTRACT, `func`: KEY_FUNC, `return`: KEY_RETURN,
 		`if`: KEY_IF, `else`: KEY_ELSE, `error`: KEY_ERROR, `warning`: KEY_WARNING, `info`: KEY_INFO,
-		`while`: KEY_WHILE, `data`: KEY_TX, `nil`: KEY_NIL, `action`: KEY_ACTION, `conditions`: KEY_COND,
+		`while`: KEY_WHILE, `for`: KEY_FOR, `in`: KEY_IN, `data`: KEY_TX, `nil`: KEY_NIL, `action`: KEY_ACTION, `conditions`: KEY_COND,
 		`true`: KEY_TRUE, `false`: KEY_FALSE, `break`: KEY_BREAK, `continue`: KEY_CONTINUE, `var`: KEY_VAR}
 	TYPES = map[string]reflect.Type{`bool`: reflect.TypeOf(true), `bytes`: reflect.TypeOf([]byte{}),
 		`int`: reflect.TypeOf(int64(0)), `address`: reflect.TypeOf(uint64(0)),
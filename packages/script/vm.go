@@ -19,6 +19,7 @@ package script
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -51,6 +52,9 @@ type RunTime struct {
 	vm     *VM
 	cost   int64
 	err    error
+	debug  *Debugger
+	// oldCost is true for the blocks before COST_BLOCK
+	oldCost bool
 	//	vars  *map[string]interface{}
 }
 
@@ -243,15 +247,83 @@ func (vm *VM) RunInit(cost int64) *RunTime {
 	return &rt
 }
 
+// blockParams returns the count of the block variables which are taken from the stack
+func blockParams(block *Block) int {
+	switch info := block.Info.(type) {
+	case *FuncInfo:
+		return len(info.Params)
+	case *ForInfo:
+		return info.Vars
+	}
+	return 0
+}
+
+// runFor runs the body of for loop for each item of the array or map.
+// The keys of map are sorted so the order of iterations is always the same.
+func (rt *RunTime) runFor(block *Block, value interface{}) (status int, err error) {
+	var keys []reflect.Value
+
+	iter := reflect.ValueOf(value)
+	isMap := iter.Kind() == reflect.Map
+	switch {
+	case isMap:
+		keys = iter.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+	case iter.Kind() != reflect.Slice && iter.Kind() != reflect.Array:
+		return 0, fmt.Errorf(`Type %v doesn't support for loop`, reflect.TypeOf(value))
+	}
+	count := block.Info.(*ForInfo).Vars
+	for i := 0; i < iter.Len(); i++ {
+		rt.cost -= COST_FOR
+		if rt.cost <= 0 {
+			return 0, fmt.Errorf(`paid CPU resource is over`)
+		}
+		var key, item interface{}
+		if isMap {
+			key = keys[i].Interface()
+			item = iter.MapIndex(keys[i]).Interface()
+		} else {
+			key = int64(i)
+			item = iter.Index(i).Interface()
+		}
+		switch {
+		case count == 2:
+			rt.stack = append(rt.stack, key, item)
+		case isMap:
+			rt.stack = append(rt.stack, key)
+		default:
+			rt.stack = append(rt.stack, item)
+		}
+		if status, err = rt.RunCode(block); err != nil {
+			return
+		}
+		if status == STATUS_CONTINUE {
+			status = STATUS_NORMAL
+			continue
+		}
+		if status == STATUS_BREAK {
+			status = STATUS_NORMAL
+			break
+		}
+		if status == STATUS_RETURN {
+			return
+		}
+	}
+	return
+}
+
 func (rt *RunTime) RunCode(block *Block) (status int, err error) {
 	top := make([]interface{}, 8)
 	start := len(rt.stack)
 	rt.blocks = append(rt.blocks, &BlockStack{block, len(rt.vars)})
+	params := blockParams(block)
 	for vkey, vpar := range block.Vars {
 		rt.cost--
 		var value interface{}
-		if block.Type == OBJ_FUNC && vkey < len(block.Info.(*FuncInfo).Params) {
-			value = rt.stack[start-len(block.Info.(*FuncInfo).Params)+vkey]
+		if vkey < params {
+			value = rt.stack[start-params+vkey]
 		} else {
 			value = reflect.New(vpar).Elem().Interface()
 			if vpar == reflect.TypeOf(map[string]interface{}{}) {
@@ -262,18 +334,25 @@ func (rt *RunTime) RunCode(block *Block) (status int, err error) {
 		}
 		rt.vars = append(rt.vars, value)
 	}
-	if block.Type == OBJ_FUNC {
-		start -= len(block.Info.(*FuncInfo).Params)
-	}
+	start -= params
 	var assign []*VarInfo
 	labels := make([]int, 0)
 	//main:
 	for ci := 0; ci < len(block.Code); ci++ { //_, cmd := range block.Code {
-		rt.cost--
+		cmd := block.Code[ci]
+		if cost, ok := CmdCost[cmd.Cmd]; ok && !rt.oldCost {
+			rt.cost -= cost
+		} else {
+			rt.cost--
+		}
 		if rt.cost <= 0 {
 			return 0, fmt.Errorf(`paid CPU resource is over`)
 		}
-		cmd := block.Code[ci]
+		if rt.debug != nil {
+			if err = rt.debugCmd(block, ci); err != nil {
+				return 0, err
+			}
+		}
 		var bin interface{}
 		size := len(rt.stack)
 		if size < int(cmd.Cmd>>8) {
@@ -310,6 +389,11 @@ func (rt *RunTime) RunCode(block *Block) (status int, err error) {
 					break
 				}
 			}
+		case CMD_FOR:
+			status, err = rt.runFor(cmd.Value.(*Block), rt.stack[size-1])
+			if status != STATUS_RETURN {
+				rt.stack = rt.stack[:size-1]
+			}
 		case CMD_LABEL:
 			labels = append(labels, ci)
 		case CMD_CONTINUE:
@@ -388,7 +472,9 @@ func (rt *RunTime) RunCode(block *Block) (status int, err error) {
 			//rt.stack = append(rt.stack, rt.vars[voff+ivar.Obj.Value.(int)])
 		case CMD_EXTEND, CMD_CALLEXTEND:
 			if val, ok := (*rt.extend)[cmd.Value.(string)]; ok {
-				rt.cost -= COST_EXTEND
+				if rt.oldCost {
+					rt.cost -= COST_EXTEND
+				}
 				if cmd.Cmd == CMD_CALLEXTEND {
 					err := rt.extendFunc(cmd.Value.(string))
 					if err != nil {
@@ -428,16 +514,31 @@ func (rt *RunTime) RunCode(block *Block) (status int, err error) {
 			itype := reflect.TypeOf(rt.stack[size-3]).String()
 			switch {
 			case itype[:3] == `map`:
+				key := rt.stack[size-2].(string)
 				if strings.Index(itype, `interface`) >= 0 {
-					rt.stack[size-3].(map[string]interface{})[rt.stack[size-2].(string)] = rt.stack[size-1]
+					if _, ok := rt.stack[size-3].(map[string]interface{})[key]; !ok && !rt.oldCost {
+						rt.cost -= COST_ITEM + int64(len(key))/COST_STRLEN
+					}
+					rt.stack[size-3].(map[string]interface{})[key] = rt.stack[size-1]
 				} else {
-					rt.stack[size-3].(map[string]string)[rt.stack[size-2].(string)] = rt.stack[size-1].(string)
+					if _, ok := rt.stack[size-3].(map[string]string)[key]; !ok && !rt.oldCost {
+						rt.cost -= COST_ITEM + int64(len(key))/COST_STRLEN
+					}
+					rt.stack[size-3].(map[string]string)[key] = rt.stack[size-1].(string)
 				}
 				rt.stack = rt.stack[:size-2]
 			case itype[:2] == `[]`:
 				ind := rt.stack[size-2].(int64)
 				if strings.Index(itype, `interface`) >= 0 {
 					slice := rt.stack[size-3].([]interface{})
+					if int(ind) >= len(slice) && !rt.oldCost {
+						// the cost is checked before the allocation of the memory,
+						// the count of new items is compared first so the multiplication can't overflow
+						if ind-int64(len(slice)) >= rt.cost/COST_ITEM {
+							return 0, fmt.Errorf(`paid CPU resource is over`)
+						}
+						rt.cost -= (ind - int64(len(slice)) + 1) * COST_ITEM
+					}
 					if int(ind) >= len(slice) {
 						slice = append(slice, make([]interface{}, int(ind)-len(slice)+1)...)
 						for i := 0; i < len(rt.vars); i++ {
@@ -490,6 +591,9 @@ func (rt *RunTime) RunCode(block *Block) (status int, err error) {
 						bin = ValueToDecimal(top[1]).Add(top[0].(decimal.Decimal))
 					} else {
 						bin = top[1].(string) + top[0].(string)
+						if !rt.oldCost {
+							rt.cost -= int64(len(bin.(string))) / COST_STRLEN
+						}
 					}
 				}
 			case float64:
@@ -669,6 +773,9 @@ func (rt *RunTime) RunCode(block *Block) (status int, err error) {
 			//			status = STATUS_ERROR
 			break
 		}
+		if rt.cost < 0 && !rt.oldCost {
+			return 0, fmt.Errorf(`paid CPU resource is over`)
+		}
 		if status == STATUS_RETURN || status == STATUS_CONTINUE || status == STATUS_BREAK {
 			break
 		}
@@ -708,6 +815,11 @@ func (rt *RunTime) Run(block *Block, params []interface{}, extend *map[string]in
 	}()
 	info := block.Info.(*FuncInfo)
 	rt.extend = extend
+	if extend != nil {
+		if blockId, ok := (*extend)[`block`].(int64); ok && blockId > 0 && blockId < COST_BLOCK {
+			rt.oldCost = true
+		}
+	}
 	if _, err = rt.RunCode(block); err == nil {
 		off := len(rt.stack) - len(info.Results)
 		//		fmt.Println(`RUN`, len(rt.stack), len(info.Results))
@@ -25,8 +25,10 @@ import (
 )
 
 type ByteCode struct {
-	Cmd   uint16
-	Value interface{}
+	Cmd    uint16
+	Value  interface{}
+	Line   uint32 // Line of the source code
+	Column uint32 // Position inside the line
 }
 
 type ByteCodes []*ByteCode
@@ -42,7 +44,61 @@ const (
 	COST_CALL     = 50
 	COST_CONTRACT = 100
 	COST_EXTEND   = 10
+	COST_FOR      = 5               // cost of each iteration of for loop
+	COST_ITEM     = 1               // cost of each new item of array or map
+	COST_STRLEN   = 32              // each COST_STRLEN bytes of the new string cost one unit
 	COST_DEFAULT  = int64(10000000) // default maximum cost of F
+	// COST_BLOCK is the first block where CmdCost, new strings and new items are charged.
+	// The contracts of the previous blocks are charged one unit per command as before.
+	COST_BLOCK = int64(400000)
+
+	TABLE_READ   = 0x01 // the function reads the table from the first parameter
+	TABLE_WRITE  = 0x02 // the function writes to the table from the first parameter
+	TABLE_PREFIX = 0x04 // the function returns the name of the table with the prefix of the state
+	TABLE_ANY    = 0x08 // the prefix of the table is defined at runtime, it is used with TABLE_PREFIX
+)
+
+var (
+	// CmdCost is the cost of the execution of each bytecode command.
+	// The calls of functions and extend values are charged additionally.
+	CmdCost = map[uint16]int64{
+		CMD_UNKNOWN:    1,
+		CMD_PUSH:       1,
+		CMD_VAR:        1,
+		CMD_EXTEND:     COST_EXTEND,
+		CMD_CALLEXTEND: COST_EXTEND,
+		CMD_PUSHSTR:    1,
+		CMD_TABLE:      1,
+		CMD_CALL:       1,
+		CMD_CALLVARI:   2,
+		CMD_RETURN:     1,
+		CMD_IF:         2,
+		CMD_ELSE:       2,
+		CMD_ASSIGNVAR:  1,
+		CMD_ASSIGN:     2,
+		CMD_LABEL:      1,
+		CMD_CONTINUE:   1,
+		CMD_WHILE:      2,
+		CMD_BREAK:      1,
+		CMD_INDEX:      2,
+		CMD_SETINDEX:   3,
+		CMD_ERROR:      1,
+		CMD_FOR:        2,
+		CMD_NOT:        1,
+		CMD_SIGN:       1,
+		CMD_ADD:        2,
+		CMD_SUB:        2,
+		CMD_MUL:        3,
+		CMD_DIV:        4,
+		CMD_AND:        1,
+		CMD_OR:         1,
+		CMD_EQUAL:      2,
+		CMD_NOTEQ:      2,
+		CMD_LESS:       2,
+		CMD_NOTLESS:    2,
+		CMD_GREAT:      2,
+		CMD_NOTGREAT:   2,
+	}
 )
 
 type ExtFuncInfo struct {
@@ -66,6 +122,7 @@ type ContractInfo struct {
 	Active bool
 	TblId  int64
 	Used   map[string]bool // Called contracts
+	Tables map[string]int  // Read and written tables, TABLE_* flags. * means the table which is unknown at compile time
 	Tx     *[]*FieldInfo
 }
 
@@ -75,6 +132,12 @@ type FuncInfo struct {
 	Variadic bool
 }
 
+// ForInfo is the information about the body of for loop
+type ForInfo struct {
+	Vars  int  // count of loop variables, they are the first variables of the block
+	Comma bool // the comma after the last variable, it is used only by the compiler
+}
+
 type VarInfo struct {
 	Obj   *ObjInfo
 	Owner *Block
@@ -101,8 +164,9 @@ type Blocks []*Block
 
 type VM struct {
 	Block
-	ExtCost func(string) int64
-	Extern  bool // extern mode of compilation
+	ExtCost    func(string) int64
+	Extern     bool           // extern mode of compilation
+	TableFuncs map[string]int // the functions which get the name of the table, TABLE_* flags
 }
 
 type ExtendData struct {
@@ -178,10 +242,14 @@ func ExecContract(rt *RunTime, name, txs string, params ...interface{}) error {
 		}
 	}
 	rt.cost -= COST_CONTRACT
-	var stackCont func(interface{}, string)
+	defer func() {
+		(*rt.extend)[`parent`] = prevparent
+	}()
 	if stack, ok := (*rt.extend)[`stack_cont`]; ok && (*rt.extend)[`parser`] != nil {
-		stackCont = stack.(func(interface{}, string))
+		stackCont := stack.(func(interface{}, string))
 		stackCont((*rt.extend)[`parser`], name)
+		// the contract is removed from the stack even if it has finished with the error
+		defer stackCont((*rt.extend)[`parser`], ``)
 	}
 	if (*rt.extend)[`parser`] != nil && isSignature {
 		obj := rt.vm.Objects[`check_signature`]
@@ -193,6 +261,7 @@ func ExecContract(rt *RunTime, name, txs string, params ...interface{}) error {
 	for _, method := range []string{`init`, `conditions`, `action`} {
 		if block, ok := (*cblock).Objects[method]; ok && block.Type == OBJ_FUNC {
 			rtemp := rt.vm.RunInit(rt.cost)
+			rtemp.debug = rt.debug
 			(*rt.extend)[`parent`] = parent
 			_, err := rtemp.Run(block.Value.(*Block), nil, rt.extend)
 			rt.cost = rtemp.cost
@@ -201,11 +270,6 @@ func ExecContract(rt *RunTime, name, txs string, params ...interface{}) error {
 			}
 		}
 	}
-	if stackCont != nil {
-		stackCont((*rt.extend)[`parser`], ``)
-	}
-	(*rt.extend)[`parent`] = prevparent
-
 	return nil
 }
 
@@ -245,6 +309,17 @@ func (vm *VM) Extend(ext *ExtendData) {
 	}
 }
 
+// ExtendTables defines the functions which work with the tables. The compiler uses them to find
+// the tables which are read and written by the contracts.
+func (vm *VM) ExtendTables(funcs map[string]int) {
+	if vm.TableFuncs == nil {
+		vm.TableFuncs = make(map[string]int)
+	}
+	for name, flags := range funcs {
+		vm.TableFuncs[name] = flags
+	}
+}
+
 func (vm *VM) getObjByName(name string) (ret *ObjInfo) {
 	var ok bool
 	names := strings.Split(name, `.`)
@@ -322,12 +397,14 @@ func (vm *VM) Call(name string, params []interface{}, extend *map[string]interfa
 	return ret, err
 }
 
-func ExContract(rt *RunTime, state uint32, name string, params map[string]interface{}) error {
+// ExContract is CallContract function. It calls the contract with the parameters from the map.
+// Missing optional fields get zero values. The callee can return the value in $result.
+func ExContract(rt *RunTime, state uint32, name string, params map[string]interface{}) (interface{}, error) {
 
 	name = StateName(state, name)
 	contract, ok := rt.vm.Objects[name]
-	if !ok {
-		return fmt.Errorf(`unknown contract %s`, name)
+	if !ok || contract.Type != OBJ_CONTRACT {
+		return nil, fmt.Errorf(`unknown contract %s`, name)
 	}
 	if params == nil {
 		params = make(map[string]interface{})
@@ -337,17 +414,45 @@ func ExContract(rt *RunTime, state uint32, name string, params map[string]interf
 	cblock := contract.Value.(*Block)
 	if cblock.Info.(*ContractInfo).Tx != nil {
 		for _, tx := range *cblock.Info.(*ContractInfo).Tx {
-			if val, ok := params[tx.Name]; !ok {
-				return fmt.Errorf(`%s is not defined`, tx.Name)
-			} else {
-				names = append(names, tx.Name)
-				vals = append(vals, val)
+			val, ok := params[tx.Name]
+			if !ok {
+				if !strings.Contains(tx.Tags, `optional`) {
+					return nil, fmt.Errorf(`%s is not defined`, tx.Name)
+				}
+				val = reflect.Zero(tx.Type).Interface()
 			}
+			names = append(names, tx.Name)
+			vals = append(vals, val)
 		}
 	}
 	if len(vals) == 0 {
 		vals = append(vals, ``)
 	}
-	//	fmt.Println(`ExContract`, name, params, names, vals)
-	return ExecContract(rt, name, strings.Join(names, `,`), vals...)
+	// the parameters of the contract must not overwrite the values of the caller with the same names
+	prevpars := make(map[string]interface{})
+	for _, ipar := range names {
+		if val, ok := (*rt.extend)[ipar]; ok {
+			prevpars[ipar] = val
+		}
+	}
+	prevresult, isresult := (*rt.extend)[`result`]
+	delete(*rt.extend, `result`)
+	err := ExecContract(rt, name, strings.Join(names, `,`), vals...)
+	result := (*rt.extend)[`result`]
+	for _, ipar := range names {
+		if val, ok := prevpars[ipar]; ok {
+			(*rt.extend)[ipar] = val
+		} else {
+			delete(*rt.extend, ipar)
+		}
+	}
+	if isresult {
+		(*rt.extend)[`result`] = prevresult
+	} else {
+		delete(*rt.extend, `result`)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
@@ -19,6 +19,7 @@ package smart
 import (
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -86,6 +87,21 @@ func CompileBlock(src, prefix string, active bool, tblid int64) (*script.Block,
 	return smartVM.CompileBlock([]rune(src), Pref2state(prefix), active, tblid)
 }
 
+// CheckContract compiles the new source code of the contract with the additional checks
+func CheckContract(src, prefix string) error {
+	return smartVM.CheckBlock([]rune(src), Pref2state(prefix))
+}
+
+// EncodeBlock returns the binary representation of the block which has been compiled by CompileBlock
+func EncodeBlock(root *script.Block) ([]byte, error) {
+	return smartVM.EncodeBlock(root)
+}
+
+// DecodeBlock restores the compiled block from the result of EncodeBlock
+func DecodeBlock(data []byte) (*script.Block, error) {
+	return smartVM.DecodeBlock(data)
+}
+
 func CompileEval(src string, prefix uint32) error {
 	return smartVM.CompileEval(src, prefix)
 }
@@ -106,13 +122,32 @@ func Extend(ext *script.ExtendData) {
 	smartVM.Extend(ext)
 }
 
+// ExtendTables defines the functions which get the name of the table as the first parameter
+func ExtendTables(funcs map[string]int) {
+	smartVM.ExtendTables(funcs)
+}
+
 func Run(block *script.Block, params []interface{}, extend *map[string]interface{}) (ret []interface{}, err error) {
+	return run(block, params, extend, nil)
+}
+
+// Debug runs the block like Run but calls the debugger at breakpoints and steps
+func Debug(block *script.Block, params []interface{}, extend *map[string]interface{},
+	debugger *script.Debugger) (ret []interface{}, err error) {
+	return run(block, params, extend, debugger)
+}
+
+func run(block *script.Block, params []interface{}, extend *map[string]interface{},
+	debugger *script.Debugger) (ret []interface{}, err error) {
 	var extcost int64
 	cost := script.COST_DEFAULT
 	if ecost, ok := (*extend)[`txcost`]; ok {
 		cost = ecost.(int64)
 	}
 	rt := smartVM.RunInit(cost)
+	if debugger != nil {
+		rt.SetDebugger(debugger)
+	}
 	ret, err = rt.Run(block, params, extend)
 	if ecost, ok := (*extend)[`txcost`]; ok && cost > ecost.(int64) {
 		extcost = cost - ecost.(int64)
@@ -170,6 +205,46 @@ func GetUsedContracts(name string, state uint32, full bool) []string {
 	return ret
 }
 
+// ContractTables contains the tables which are read and written by the contract
+type ContractTables struct {
+	Read  []string `json:"read"`
+	Write []string `json:"write"`
+}
+
+// GetContractTables returns the tables which the contract reads and writes. If full is true then
+// the tables of the called contracts are added too. * means the table which is unknown before execution.
+func GetContractTables(name string, state uint32, full bool) *ContractTables {
+	contract := GetContract(name, state)
+	if contract == nil {
+		return nil
+	}
+	tables := make(map[string]int)
+	for table, flags := range contract.Block.Info.(*script.ContractInfo).Tables {
+		tables[table] |= flags
+	}
+	if full {
+		for _, used := range GetUsedContracts(name, state, true) {
+			if sub := GetContract(used, state); sub != nil {
+				for table, flags := range sub.Block.Info.(*script.ContractInfo).Tables {
+					tables[table] |= flags
+				}
+			}
+		}
+	}
+	ret := &ContractTables{Read: make([]string, 0), Write: make([]string, 0)}
+	for table, flags := range tables {
+		if flags&script.TABLE_READ != 0 {
+			ret.Read = append(ret.Read, table)
+		}
+		if flags&script.TABLE_WRITE != 0 {
+			ret.Write = append(ret.Write, table)
+		}
+	}
+	sort.Strings(ret.Read)
+	sort.Strings(ret.Write)
+	return ret
+}
+
 // Returns true if the contract exists
 func GetContractById(id int32 /*, p *Parser*/) *Contract {
 	idcont := id // - CNTOFF
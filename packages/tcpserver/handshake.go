@@ -0,0 +1,82 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package tcpserver
+
+import (
+	"fmt"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+)
+
+/*
+ * Первым сообщением соединения должен быть handshake. В ответ шлем 1 байт статуса и
+ * свой handshake, если статус 1, или причину отказа, если статус 0.
+ * Пока LEGACY_TCP, старые ноды могут сразу слать тип данных без handshake
+ */
+
+// legacy returns true if the request of the node without the handshake is accepted
+func legacy(dataType int64) bool {
+	if !consts.LEGACY_TCP {
+		return false
+	}
+	for _, item := range utils.LegacyDataTypes {
+		if item == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TcpServer) handshake(dataType int64) (*utils.Handshake, error) {
+	if dataType != consts.DATA_TYPE_HANDSHAKE {
+		return nil, t.refuse(fmt.Errorf(`handshake is required, got data type %d`, dataType))
+	}
+	data, err := utils.TCPGetSizeAndData(t.Conn, utils.HANDSHAKE_MAX_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := utils.ParseHandshake(data)
+	if err == nil {
+		err = peer.Check()
+	}
+	if err != nil {
+		return nil, t.refuse(err)
+	}
+	if err = t.Authenticate(peer); err != nil {
+		return nil, t.refuse(err)
+	}
+	my, err := t.NewHandshake()
+	if err != nil {
+		return nil, t.refuse(fmt.Errorf(`internal error`))
+	}
+	if _, err = t.Conn.Write([]byte{1}); err != nil {
+		return nil, err
+	}
+	if err = utils.WriteSizeAndData(my.Bytes(), t.Conn); err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+// refuse sends the reason of the refusal to the node and returns it
+func (t *TcpServer) refuse(reason error) error {
+	if _, err := t.Conn.Write([]byte{0}); err == nil {
+		utils.WriteSizeAndData([]byte(reason.Error()), t.Conn)
+	}
+	return reason
+}
@@ -23,6 +23,7 @@ import (
 	//	"runtime"
 	"sync"
 
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
 	"github.com/op/go-logging"
 )
@@ -30,7 +31,11 @@ import (
 var (
 	log     = logging.MustGetLogger("tcpserver")
 	counter int64
-	mutex   = &sync.Mutex{}
+	// кол-во соединений в режиме мультиплексирования
+	muxCounter int64
+	// кол-во соединений с каждого IP
+	hosts = make(map[string]int)
+	mutex = &sync.Mutex{}
 )
 
 func init() {
@@ -40,12 +45,18 @@ func init() {
 type TcpServer struct {
 	*utils.DCDB
 	Conn net.Conn
+	// host - IP нода, counted - счетчик, в котором учтено соединение
+	host    string
+	counted *int64
 }
 
 func (t *TcpServer) deferClose() {
 	t.Conn.Close()
 	mutex.Lock()
-	counter--
+	*t.counted--
+	if hosts[t.host]--; hosts[t.host] <= 0 {
+		delete(hosts, t.host)
+	}
 	//	fmt.Println("--", counter)
 	mutex.Unlock()
 }
@@ -59,18 +70,21 @@ func (t *TcpServer) HandleTcpRequest() {
 	var err error
 
 	log.Debug("HandleTcpRequest from %v", t.Conn.RemoteAddr())
-	defer t.deferClose()
 
+	t.host = utils.PeerHost(t.Conn.RemoteAddr().String())
 	mutex.Lock()
-	if counter > 20 {
+	if counter >= consts.MAX_TCP_CONNECTIONS || hosts[t.host] >= consts.MAX_HOST_CONNECTIONS {
 		t.Conn.Close()
 		mutex.Unlock()
 		return
 	} else {
 		counter++
+		hosts[t.host]++
+		t.counted = &counter
 		//		fmt.Println("++", counter)
 	}
 	mutex.Unlock()
+	defer t.deferClose()
 
 	// тип данных
 	buf := make([]byte, 2)
@@ -80,7 +94,55 @@ func (t *TcpServer) HandleTcpRequest() {
 		return
 	}
 	dataType := utils.BinToDec(buf)
+	if legacy(dataType) {
+		log.Debug("legacy dataType %v from %v", dataType, t.Conn.RemoteAddr())
+		t.handle(dataType)
+		return
+	}
+	peer, err := t.handshake(dataType)
+	if err != nil {
+		log.Error("refused %v: %v", t.Conn.RemoteAddr(), err)
+		return
+	}
+	log.Debug("node %x full node %d version %d block_id %d", peer.PublicKey, peer.FullNodeId, peer.Version,
+		peer.BlockId)
+
+	// тип данных
+	_, err = t.Conn.Read(buf)
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+		return
+	}
+	dataType = utils.BinToDec(buf)
 	log.Debug("dataType %v", dataType)
+	if dataType == consts.DATA_TYPE_MUX {
+		// постоянное соединение переходит из counter в muxCounter, чтобы не занимать места обычных запросов
+		mutex.Lock()
+		if muxCounter >= consts.MAX_MUX_CONNECTIONS {
+			mutex.Unlock()
+			log.Error("too many mux connections, refused %v", t.Conn.RemoteAddr())
+			return
+		}
+		counter--
+		muxCounter++
+		t.counted = &muxCounter
+		mutex.Unlock()
+		t.mux(peer)
+	} else {
+		t.handle(dataType)
+	}
+	log.Debug("END")
+}
+
+// mux serves the persistent connection. Every request is handled by the separate TcpServer.
+func (t *TcpServer) mux(peer *utils.Handshake) {
+	err := utils.NewMuxConn(t.Conn, peer).Serve(func(stream *utils.Stream, dataType int64) {
+		(&TcpServer{DCDB: t.DCDB, Conn: stream}).handle(dataType)
+	})
+	log.Debug("connection with %v is closed: %v", t.Conn.RemoteAddr(), err)
+}
+
+func (t *TcpServer) handle(dataType int64) {
 	switch dataType {
 	case 1:
 		t.Type1()
@@ -92,6 +154,11 @@ func (t *TcpServer) HandleTcpRequest() {
 		t.Type7()
 	case 10:
 		t.Type10()
+	case 11:
+		t.Type11()
+	case 12:
+		t.Type12()
+	default:
+		log.Error("unknown data type %d from %v", dataType, t.Conn.RemoteAddr())
 	}
-	log.Debug("END")
 }
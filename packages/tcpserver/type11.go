@@ -0,0 +1,67 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package tcpserver
+
+import (
+	"io"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+)
+
+/* Выдаем тела блоков с from по to. Каждый блок - 4 байта размера и данные, в конце 4 нулевых байта.
+ * Отдаем не более BLOCKS_BATCH_COUNT блоков и BLOCKS_BATCH_SIZE байт, но хотя бы один блок
+ * запрос шлет демон blocksCollection через utils.DownloadBlocks()
+ */
+
+func (t *TcpServer) Type11() {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(t.Conn, buf)
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+		return
+	}
+	from, to := utils.BinToDec(buf[:4]), utils.BinToDec(buf[4:])
+	if to-from >= consts.BLOCKS_BATCH_COUNT {
+		to = from + consts.BLOCKS_BATCH_COUNT - 1
+	}
+	log.Debug("blocks %d-%d", from, to)
+	rows, err := t.QueryRows("SELECT data FROM block_chain WHERE id >= ? AND id <= ? ORDER BY id", from, to)
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+		t.Conn.Write(utils.DecToBin(0, 4))
+		return
+	}
+	defer rows.Close()
+	var size int64
+	for size < consts.BLOCKS_BATCH_SIZE && rows.Next() {
+		var block []byte
+		if err = rows.Scan(&block); err != nil {
+			log.Error("%v", utils.ErrInfo(err))
+			break
+		}
+		if err = utils.WriteSizeAndData(block, t.Conn); err != nil {
+			log.Error("%v", utils.ErrInfo(err))
+			return
+		}
+		size += int64(len(block))
+	}
+	_, err = t.Conn.Write(utils.DecToBin(0, 4))
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package tcpserver
+
+import (
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/utils"
+)
+
+/* Обмен адресами: получаем хост запросившего нода и добавляем его в адресную книгу,
+ * в ответ отдаем не более PEERS_COUNT хостов, которые не забанены
+ * запрос шлет демон PeersExchange через utils.RequestPeers()
+ */
+
+func (t *TcpServer) Type12() {
+	data, err := utils.TCPGetSizeAndData(t.Conn, 256)
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+		return
+	}
+	if size := utils.DecodeLength(&data); size > 0 && int64(len(data)) >= size {
+		if err = t.AddPeers(t.Conn.RemoteAddr().String(), []string{string(utils.BytesShift(&data, size))}); err != nil {
+			log.Error("%v", utils.ErrInfo(err))
+		}
+	}
+	hosts, err := t.GetHosts()
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+	}
+	if len(hosts) > consts.PEERS_COUNT {
+		hosts = hosts[:consts.PEERS_COUNT]
+	}
+	err = utils.WriteSizeAndData(utils.EncodePeers(hosts), t.Conn)
+	if err != nil {
+		log.Error("%v", utils.ErrInfo(err))
+	}
+}
@@ -21,7 +21,7 @@ import (
 )
 
 /* Выдаем тело указанного блока
- * запрос шлет демон blocksCollection и queue_parser_blocks через p.GetBlocks()
+ * запрос шлет демон blocksCollection и queue_parser_blocks через p.Reorg()
  */
 
 func (t *TcpServer) Type7() {
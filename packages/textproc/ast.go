@@ -0,0 +1,674 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package textproc
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type node interface{}
+
+// textNode is the text which is output as is
+type textNode string
+
+// newLineNode is the new line which is output if the output isn't empty
+type newLineNode struct{}
+
+// varNode is #name# variable of the macro. The macro continues with found or notFound segment
+// depending on whether the variable exists
+type varNode struct {
+	name     string
+	found    segKey
+	notFound segKey
+}
+
+// lookNode is the bracket which can follow the name of the function. The name is looked for in
+// the end of the output, so the macro continues depending on the output.
+type lookNode struct {
+	next segKey
+}
+
+// callNode is the function or the map which is called inside the macro
+type callNode struct {
+	prog *Program
+	hash bool // the name of the function follows syschar
+}
+
+// funcNode is the call of the function
+type funcNode struct {
+	name   string
+	pos    int
+	params []*param
+	tail   forTail
+}
+
+// mapNode is the call of the map function
+type mapNode struct {
+	name   string
+	pos    int
+	params map[string]*param
+	tail   forTail
+}
+
+// forTail is the rest of the source after the call. If the call has started ForList loop then
+// the text till ForListEnd is the body of the loop and the rest of the source is parsed on demand.
+type forTail struct {
+	next int
+	once sync.Once
+	prog *Program
+}
+
+// param is the parameter of the function or the map
+type param struct {
+	raw   string
+	pos   int // the offset of the parameter in the source
+	asis  bool
+	prog  *Program
+	macro *macroProg
+}
+
+// Program is the parsed source of Process
+type Program struct {
+	src    string
+	nodes  []node
+	null   bool // the source is not the list of the functions, Process returns NULL after nodes
+	head   forTail
+	err    string // the syntax error which has been found while parsing
+	errPos int
+}
+
+type segKey struct {
+	pos    int
+	isName bool
+	isMap  int
+	isFunc int
+	fname  string // the name of the function which has been found before the bracket
+}
+
+// segment is the part of the macro till the next variable or the next bracket
+type segment struct {
+	nodes []node
+}
+
+// macroProg is the parsed source of Macro. The segments are parsed on demand.
+type macroProg struct {
+	sync.RWMutex
+	src      []rune
+	segments map[segKey]*segment
+}
+
+// Parse returns the parsed source of Process. The result is not cached here, because the source can be
+// supplied by the request. The parsed pages are kept by the caller (see utils.GetPageTemplate).
+func Parse(input string) *Program {
+	return parseProgram(input, true)
+}
+
+func newParam(raw string, pos int, asis bool) *param {
+	// pos is the offset of the untrimmed parameter
+	par := &param{raw: strings.TrimSpace(raw), pos: pos + len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace)),
+		asis: asis}
+	raw = par.raw
+	if !asis {
+		par.prog = parseProgram(raw, true)
+		par.macro = parseMacro(raw)
+	}
+	return par
+}
+
+func newFunc(name string, pos int, params [][]rune, parPos []int, next int) *funcNode {
+	fnode := &funcNode{name: name, pos: pos, params: make([]*param, len(params)), tail: forTail{next: next}}
+	for i, item := range params {
+		ipar := strings.TrimSpace(string(item))
+		off := strings.Index(ipar, `#=`)
+		fnode.params[i] = newParam(string(item), parPos[i], off >= 0 && off == strings.Index(ipar, `#`))
+	}
+	return fnode
+}
+
+func newMap(name string, pos int, params map[string]string, parPos map[string]int, next int) *mapNode {
+	mnode := &mapNode{name: name, pos: pos, params: make(map[string]*param), tail: forTail{next: next}}
+	for key, item := range params {
+		ipar := strings.TrimSpace(item)
+		mnode.params[key] = newParam(item, parPos[key], len(ipar) == 0 || ipar[0] == '[')
+	}
+	return mnode
+}
+
+// parseProgram splits the source into the calls of the functions and the maps.
+// noproc is false if the source is the rest of the list of the functions.
+func parseProgram(input string, noproc bool) *Program {
+	var (
+		isFunc, isMap, isArr     int
+		params                   [][]rune
+		pmap                     map[string]string
+		isKey, toLine            bool
+		pair                     rune
+		namePos, callPos, valPos int
+		parPos                   []int
+		mapPos                   map[string]int
+	)
+	prog := &Program{src: input, nodes: make([]node, 0)}
+	name := make([]rune, 0, 128)
+	key := make([]rune, 0, 128)
+	value := make([]rune, 0, 128)
+	addFunc := func(next int) {
+		prog.nodes = append(prog.nodes, newFunc(string(name), callPos, params, parPos, next))
+		name = name[:0]
+	}
+	addPar := func(off int, ch rune) {
+		if len(params[len(params)-1]) == 0 {
+			parPos[len(params)-1] = off
+		}
+		params[len(params)-1] = append(params[len(params)-1], ch)
+	}
+	addValue := func(off int, ch rune) {
+		if len(value) == 0 {
+			valPos = off
+		}
+		value = append(value, ch)
+	}
+	setValue := func() {
+		ikey := strings.TrimSpace(string(key))
+		pmap[ikey] = string(value)
+		mapPos[ikey] = valPos
+	}
+	fail := func(pos int, format string, args ...interface{}) *Program {
+		prog.null = true
+		prog.err = fmt.Sprintf(format, args...)
+		prog.errPos = pos
+		return prog
+	}
+	for off, ch := range input {
+		if isMap > 0 {
+			if pair > 0 {
+				if ch != pair {
+					addValue(off, ch)
+				} else {
+					pair = 0
+				}
+				continue
+			}
+			if !isKey && len(value) == 0 {
+				if ch >= '!' {
+					if ch == '"' || ch == '`' {
+						pair = ch
+					} else {
+						if ch == '[' {
+							isArr++
+						}
+						addValue(off, ch)
+					}
+				}
+				continue
+			}
+			if ch == '}' {
+				isMap--
+				setValue()
+				prog.nodes = append(prog.nodes, newMap(string(name), callPos, pmap, mapPos, off+1))
+				name = name[:0]
+			}
+			if isKey {
+				if ch < '!' {
+					continue
+				}
+				if isKey && ch == ':' {
+					isKey = false
+					value = value[:0]
+					continue
+				}
+				key = append(key, ch)
+				continue
+			}
+			if isArr == 0 && (ch == 0xa || ch == ',') {
+				setValue()
+				isKey = true
+				key = key[:0]
+				value = value[:0]
+			}
+			if ch == '[' {
+				isArr++
+			}
+			if ch == ']' {
+				isArr--
+			}
+			addValue(off, ch)
+			continue
+		}
+		if isFunc > 0 {
+			if pair > 0 {
+				if ch != pair {
+					addPar(off, ch)
+				} else {
+					pair = 0
+				}
+				continue
+			}
+			if len(params[len(params)-1]) == 0 && ch != ')' && ch != ',' && !toLine {
+				if ch >= '!' {
+					if ch == '"' || ch == '`' {
+						pair = ch
+					} else {
+						addPar(off, ch)
+					}
+				}
+				continue
+			}
+			if toLine {
+				if ch == 0xa {
+					isFunc = 0
+					addFunc(off + 1)
+				} else {
+					addPar(off, ch)
+				}
+			} else {
+				if ch == ')' {
+					isFunc--
+					if isFunc == 0 {
+						addFunc(off + 1)
+						continue
+					}
+				}
+				if ch == '(' {
+					isFunc++
+				}
+				if ch == ',' && isFunc == 1 {
+					params = append(params, make([]rune, 0))
+					parPos = append(parPos, off+1)
+				} else {
+					addPar(off, ch)
+				}
+			}
+			continue
+		}
+		if ch == 0xa {
+			prog.nodes = append(prog.nodes, newLineNode{})
+		}
+		if ch < '!' {
+			continue
+		}
+		if ch == '(' || ch == ':' || ch == '{' {
+			if len(name) == 0 {
+				return fail(off, `unexpected %c`, ch)
+			}
+			callPos = namePos
+		}
+		if ch == '(' || ch == ':' {
+			if _, ok := engine.funcs[string(name)]; !ok {
+				return fail(namePos, `unknown function %s`, string(name))
+			}
+			noproc = false
+			params = make([][]rune, 1)
+			params[0] = make([]rune, 0)
+			parPos = []int{off + 1}
+			isFunc++
+			toLine = ch == ':'
+		} else if ch == '{' {
+			if _, ok := engine.maps[string(name)]; !ok {
+				return fail(namePos, `unknown map %s`, string(name))
+			}
+			pmap = make(map[string]string)
+			mapPos = make(map[string]int)
+			isKey = true
+			noproc = false
+			key = key[:0]
+			isMap++
+		} else {
+			if len(name) == 0 {
+				namePos = off
+			}
+			name = append(name, ch)
+			if len(name) > 64 {
+				return fail(namePos, `unexpected text %s`, string(name))
+			}
+		}
+	}
+	if toLine && isFunc > 0 {
+		addFunc(len(input))
+	} else if isFunc > 0 {
+		prog.err = fmt.Sprintf(`unclosed bracket of %s`, string(name))
+		prog.errPos = callPos
+	} else if isMap > 0 {
+		prog.err = fmt.Sprintf(`unterminated map %s`, string(name))
+		prog.errPos = callPos
+	} else if len(name) > 0 {
+		prog.err = fmt.Sprintf(`unexpected text %s`, string(name))
+		prog.errPos = namePos
+	}
+	prog.null = noproc
+	return prog
+}
+
+// parseMacro prepares the source of Macro. The source is split into the segments. Each segment ends
+// with the variable or the bracket, so the macro continues with the segment depending on the result.
+func parseMacro(input string) *macroProg {
+	return &macroProg{src: []rune(input), segments: make(map[segKey]*segment)}
+}
+
+func (macro *macroProg) segment(key segKey) *segment {
+	macro.RLock()
+	seg, ok := macro.segments[key]
+	macro.RUnlock()
+	if !ok {
+		seg = parseSegment(macro.src, key)
+		macro.Lock()
+		macro.segments[key] = seg
+		macro.Unlock()
+	}
+	return seg
+}
+
+func parseSegment(input []rune, key segKey) *segment {
+	seg := &segment{nodes: make([]node, 0)}
+	result := make([]rune, 0, len(input)-key.pos)
+	name := make([]rune, 0, 128)
+	isName := key.isName
+	hash := key.isName
+	isFunc := key.isFunc
+	isMap := key.isMap
+	if len(key.fname) > 0 {
+		isName = true
+		hash = false
+		isFunc++
+		name = append(append(name, []rune(key.fname)...), '(')
+	}
+	flush := func() {
+		if len(result) > 0 {
+			seg.nodes = append(seg.nodes, textNode(result))
+			result = result[:0]
+		}
+	}
+	clearname := func() {
+		result = append(append(result, engine.syschar), name...)
+		isName = false
+		name = name[:0]
+	}
+	call := func() {
+		flush()
+		seg.nodes = append(seg.nodes, &callNode{parseProgram(string(name), true), hash})
+		isName = false
+		name = name[:0]
+	}
+	for i := key.pos; i < len(input); i++ {
+		r := input[i]
+		if r != engine.syschar || isFunc > 0 {
+			if isName {
+				name = append(name, r)
+				if r == '(' && isMap == 0 {
+					if isFunc == 0 {
+						if _, ok := engine.funcs[string(name[:len(name)-1])]; !ok {
+							clearname()
+							continue
+						}
+					}
+					isFunc++
+				} else if r == '{' && isFunc == 0 {
+					if isMap == 0 {
+						if _, ok := engine.maps[string(name[:len(name)-1])]; !ok {
+							clearname()
+							continue
+						}
+					}
+					isMap++
+				} else if r == ')' && isFunc > 0 {
+					if isFunc--; isFunc == 0 {
+						call()
+					}
+				} else if r == '}' && isMap > 0 {
+					if isMap--; isMap == 0 {
+						call()
+					}
+				} else if (len(name) > 64 && isFunc == 0) || r < ' ' || (r == ' ' && isFunc == 0 && isMap == 0) {
+					clearname()
+				}
+			} else {
+				if r == '(' {
+					name = name[:0]
+					j := len(result) - 1
+					for ; j >= 0; j-- {
+						if (result[j] >= 'a' && result[j] <= 'z') ||
+							(result[j] >= 'A' && result[j] <= 'Z') {
+							name = append(name, result[j])
+						} else {
+							break
+						}
+					}
+					if j < 0 {
+						// the name can begin in the previous output
+						flush()
+						seg.nodes = append(seg.nodes, &lookNode{segKey{pos: i, isMap: isMap, isFunc: isFunc}})
+						return seg
+					}
+					if len(name) > 0 {
+						for i, j := 0, len(name)-1; i < j; i, j = i+1, j-1 {
+							name[i], name[j] = name[j], name[i]
+						}
+						if _, ok := engine.funcs[string(name)]; ok {
+							isName = true
+							hash = false
+							isFunc++
+							result = result[:len(result)-len(name)]
+							name = append(name, '(')
+							continue
+						}
+						name = name[:0]
+					}
+				}
+				result = append(result, r)
+			}
+			continue
+		}
+		if isName {
+			flush()
+			seg.nodes = append(seg.nodes, &varNode{name: string(name), found: segKey{pos: i + 1, isMap: isMap},
+				notFound: segKey{pos: i + 1, isName: true, isMap: isMap}})
+			return seg
+		}
+		isName = true
+		hash = true
+	}
+	if isName {
+		result = append(append(result, engine.syschar), name...)
+	}
+	flush()
+	return seg
+}
+
+// value returns the parameter of the function. raw is true if the variables must not be escaped.
+func (par *param) value(vars *map[string]string, raw bool) string {
+	if par.asis {
+		return par.raw
+	}
+	val := par.prog.process(vars, raw)
+	if val == `NULL` {
+		val = par.macro.execute(0, vars, raw, false)
+	}
+	return val
+}
+
+func (fnode *funcNode) execute(vars *map[string]string) string {
+	if (strings.HasSuffix((*vars)[`ifs`], `0`) || strings.HasSuffix((*vars)[`ifs`], `-`)) && fnode.name != `If` &&
+		fnode.name != `IfEnd` && fnode.name != `Else` && fnode.name != `ElseIf` {
+		return ``
+	}
+	pars := make([]string, len(fnode.params))
+	info := infos[fnode.name]
+	for i, par := range fnode.params {
+		if info.Body && i == len(fnode.params)-1 {
+			pars[i] = par.raw
+		} else {
+			pars[i] = par.value(vars, info.Raw)
+		}
+	}
+	return engine.funcs[fnode.name](vars, pars...)
+}
+
+func (mnode *mapNode) execute(vars *map[string]string) string {
+	if strings.HasSuffix((*vars)[`ifs`], `0`) || strings.HasSuffix((*vars)[`ifs`], `-`) {
+		return ``
+	}
+	pars := make(map[string]string, len(mnode.params))
+	raw := infos[mnode.name].Raw
+	for key, par := range mnode.params {
+		pars[key] = par.value(vars, raw)
+	}
+	return engine.maps[mnode.name](vars, &pars)
+}
+
+// forLoop saves the body of ForList loop which starts at the offset of the source. It returns
+// the rest of the source after the body or nil if ForListEnd has not been found.
+func (prog *Program) forLoop(tail *forTail, noproc bool, vars *map[string]string) *Program {
+	end := strings.Index(prog.src[tail.next:], `ForListEnd`)
+	if end < 0 || tail.next+end+10 >= len(prog.src) {
+		return nil
+	}
+	(*vars)[`for_body`] = prog.src[tail.next : tail.next+end]
+	(*vars)[`for_loop`] = `0`
+	tail.once.Do(func() {
+		tail.prog = parseProgram(prog.src[tail.next+end:], noproc)
+	})
+	return tail.prog
+}
+
+// render writes the result of the nodes to out. It returns false if the result is NULL.
+// The text results of the functions are escaped if raw is false.
+func (prog *Program) render(out *bytes.Buffer, vars *map[string]string, raw bool) bool {
+	for _, item := range prog.nodes {
+		var (
+			tail   *forTail
+			result string
+			name   string
+		)
+		switch v := item.(type) {
+		case newLineNode:
+			if out.Len() > 0 {
+				out.WriteString("\n")
+			}
+			continue
+		case *funcNode:
+			result, name, tail = v.execute(vars), v.name, &v.tail
+		case *mapNode:
+			result, name, tail = v.execute(vars), v.name, &v.tail
+		}
+		if !raw && infos[name].Text {
+			result = html.EscapeString(result)
+		}
+		out.WriteString(result)
+		if (*vars)[`for_loop`] == `1` {
+			if rest := prog.forLoop(tail, false, vars); rest != nil {
+				return rest.render(out, vars, raw)
+			}
+			return true
+		}
+	}
+	return !prog.null
+}
+
+// Process returns the result of the parsed functions for HTML
+func (prog *Program) Process(vars *map[string]string) string {
+	return prog.process(vars, false)
+}
+
+func (prog *Program) process(vars *map[string]string, raw bool) string {
+	var out bytes.Buffer
+	if (*vars)[`for_loop`] == `1` {
+		// the beginning of the source is the body of the loop which has been started before
+		if prog = prog.forLoop(&prog.head, true, vars); prog == nil {
+			return `NULL`
+		}
+	}
+	if !prog.render(&out, vars, raw) {
+		return `NULL`
+	}
+	return out.String()
+}
+
+// execute returns the result of the macro. If raw is false then the values of the untrusted variables
+// are escaped. escape is true if the macro is the value of the untrusted variable, in this case
+// the text is escaped and the functions are not called.
+func (macro *macroProg) execute(level int, vars *map[string]string, raw, escape bool) string {
+	var out bytes.Buffer
+	seg := macro.segment(segKey{})
+	for seg != nil {
+		var next *segment
+		for _, item := range seg.nodes {
+			switch v := item.(type) {
+			case textNode:
+				if escape {
+					out.WriteString(html.EscapeString(string(v)))
+				} else {
+					out.WriteString(string(v))
+				}
+			case *callNode:
+				if escape {
+					if v.hash {
+						out.WriteRune(engine.syschar)
+					}
+					out.WriteString(html.EscapeString(v.prog.src))
+				} else {
+					out.WriteString(v.prog.process(vars, raw))
+				}
+			case *varNode:
+				if value, ok := (*vars)[v.name]; ok {
+					unsafe := !raw && !IsSafe(vars, v.name)
+					if level < 10 && len(value) > 0 {
+						value = parseMacro(value).execute(level+1, vars, raw, unsafe)
+					} else if unsafe {
+						value = html.EscapeString(value)
+					}
+					out.WriteString(value)
+					next = macro.segment(v.found)
+				} else {
+					out.WriteRune(engine.syschar)
+					if escape {
+						out.WriteString(html.EscapeString(v.name))
+					} else {
+						out.WriteString(v.name)
+					}
+					next = macro.segment(v.notFound)
+				}
+			case *lookNode:
+				key := v.next
+				if escape {
+					out.WriteRune('(')
+					key.pos++
+					next = macro.segment(key)
+					continue
+				}
+				data := out.Bytes()
+				i := len(data)
+				for i > 0 && ((data[i-1] >= 'a' && data[i-1] <= 'z') || (data[i-1] >= 'A' && data[i-1] <= 'Z')) {
+					i--
+				}
+				if _, ok := engine.funcs[string(data[i:])]; ok && i < len(data) {
+					key.fname = string(data[i:])
+					out.Truncate(i)
+				} else {
+					out.WriteRune('(')
+				}
+				key.pos++
+				next = macro.segment(key)
+			}
+		}
+		seg = next
+	}
+	return out.String()
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package textproc
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// INCLUDE_DEPTH is the maximum depth of the nested includes
+const INCLUDE_DEPTH = 10
+
+// The depth of the includes and the components are kept in the reserved variables, so they can't be
+// assigned by the request (see IsReserved).
+const (
+	includeVar   = `#include`
+	componentVar = `#component_`
+)
+
+// PageLoader returns the parsed page by its name. It returns nil if the page has not been found.
+type PageLoader func(vars *map[string]string, name string) (*Program, error)
+
+var loader PageLoader
+
+// SetLoader sets the function which loads the pages for Include
+func SetLoader(load PageLoader) {
+	loader = load
+}
+
+// Component declares the named block. The first parameter is the name of the component, the last one
+// is the body and the parameters between them are the names of the variables which can be passed
+// by Include. The body is not processed here, so it should be quoted by backquotes if it has commas.
+func Component(vars *map[string]string, pars ...string) string {
+	if len(pars) < 2 {
+		return ``
+	}
+	name := strings.TrimSpace(pars[0])
+	keys := make([]string, 0, len(pars)-2)
+	for _, key := range pars[1 : len(pars)-1] {
+		keys = append(keys, strings.TrimSpace(key))
+	}
+	(*vars)[componentVar+name] = pars[len(pars)-1]
+	(*vars)[componentVar+name+`_params`] = strings.Join(keys, `,`)
+	return ``
+}
+
+// Include outputs the component or the page with the parameters like key=value. The components are
+// looked for before the pages. The parameters are the variables which are available only inside
+// the included source.
+func Include(vars *map[string]string, pars ...string) string {
+	var (
+		prog *Program
+		keys []string
+		err  error
+	)
+	name := strings.TrimSpace(pars[0])
+	depth, _ := strconv.Atoi((*vars)[includeVar])
+	if depth >= INCLUDE_DEPTH {
+		return fmt.Sprintf(`Include %s: too many nested includes`, html.EscapeString(name))
+	}
+	if body, ok := (*vars)[componentVar+name]; ok {
+		prog = Parse(body)
+		if params := (*vars)[componentVar+name+`_params`]; len(params) > 0 {
+			keys = strings.Split(params, `,`)
+		}
+	} else if loader != nil {
+		if prog, err = loader(vars, name); err != nil {
+			return err.Error()
+		}
+	}
+	if prog == nil {
+		return ``
+	}
+	// saved contains the previous values of the variables which are changed by the parameters
+	saved := make(map[string]*string)
+	assign := func(key, value string) {
+		for _, item := range []string{key, string(engine.syschar) + key} {
+			if _, ok := saved[item]; ok {
+				continue
+			}
+			if prev, ok := (*vars)[item]; ok {
+				saved[item] = &prev
+			} else {
+				saved[item] = nil
+			}
+		}
+		SetSafe(vars, key, value)
+	}
+	for _, key := range keys {
+		assign(key, ``)
+	}
+	for _, item := range pars[1:] {
+		if lr := strings.SplitN(item, `=`, 2); len(lr) == 2 && len(strings.TrimSpace(lr[0])) > 0 {
+			assign(strings.TrimSpace(lr[0]), strings.TrimSpace(lr[1]))
+		}
+	}
+	(*vars)[includeVar] = strconv.Itoa(depth + 1)
+	out := prog.Process(vars)
+	if out == `NULL` {
+		out = Macro(prog.src, vars)
+	}
+	(*vars)[includeVar] = strconv.Itoa(depth)
+	for key, prev := range saved {
+		if prev == nil {
+			delete(*vars, key)
+		} else {
+			(*vars)[key] = *prev
+		}
+	}
+	return out
+}
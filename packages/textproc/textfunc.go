@@ -18,6 +18,7 @@ package textproc
 
 import (
 	"fmt"
+	"strings"
 )
 
 func Link(vars *map[string]string, pars ...string) string {
@@ -48,3 +49,8 @@ func Tag(vars *map[string]string, pars ...string) string {
 func Break(vars *map[string]string, pars ...string) string {
 	return `<br>`
 }
+
+// Raw returns the parameters with the variables which are substituted without the escaping
+func Raw(vars *map[string]string, pars ...string) string {
+	return strings.Join(pars, `,`)
+}
@@ -16,12 +16,6 @@
 
 package textproc
 
-import (
-	// "fmt"
-	"strings"
-	"unicode/utf8"
-)
-
 type TextFunc func(*map[string]string, ...string) string
 type MapFunc func(*map[string]string, *map[string]string) string
 
@@ -38,111 +32,16 @@ var (
 func init() {
 	engine = TextProc{syschar: '#', maps: make(map[string]MapFunc)}
 	engine.funcs = map[string]TextFunc{
-		`BR`:   Break,
-		`Link`: Link,
-		`Tag`:  Tag,
-	}
-}
-
-func replace(input string, level int, vars *map[string]string) string {
-	if len(input) == 0 {
-		return input
-	}
-	length := utf8.RuneCountInString(input)
-	result := make([]rune, 0, length)
-	isName := false
-	isFunc := 0
-	isMap := 0
-	name := make([]rune, 0, 128)
-	clearname := func() {
-		result = append(append(result, engine.syschar), name...)
-		isName = false
-		name = name[:0]
-	}
-	for _, r := range input {
-		if r != engine.syschar || isFunc > 0 {
-			if isName {
-				name = append(name, r)
-				if r == '(' && isMap == 0 {
-					if isFunc == 0 {
-						if _, ok := engine.funcs[string(name[:len(name)-1])]; !ok {
-							clearname()
-							continue
-						}
-					}
-					isFunc++
-				} else if r == '{' && isFunc == 0 {
-					if isMap == 0 {
-						if _, ok := engine.maps[string(name[:len(name)-1])]; !ok {
-							clearname()
-							continue
-						}
-					}
-					isMap++
-				} else if r == ')' && isFunc > 0 {
-					if isFunc--; isFunc == 0 {
-						result = append(result, []rune(Process(string(name), vars))...)
-						isName = false
-						name = name[:0]
-					}
-				} else if r == '}' && isMap > 0 {
-					if isMap--; isMap == 0 {
-						result = append(result, []rune(Process(string(name), vars))...)
-						isName = false
-						name = name[:0]
-					}
-				} else if (len(name) > 64 && isFunc == 0) || r < ' ' || (r == ' ' && isFunc == 0 && isMap == 0) {
-					clearname()
-				}
-			} else {
-				if r == '(' {
-					name = name[:0]
-					for i := len(result) - 1; i >= 0; i-- {
-						if (result[i] >= 'a' && result[i] <= 'z') ||
-							(result[i] >= 'A' && result[i] <= 'Z') {
-							name = append(name, result[i])
-						} else {
-							break
-						}
-					}
-					if len(name) > 0 {
-						for i, j := 0, len(name)-1; i < j; i, j = i+1, j-1 {
-							name[i], name[j] = name[j], name[i]
-						}
-						if _, ok := engine.funcs[string(name)]; ok {
-							isName = true
-							isFunc++
-							result = result[:len(result)-len(name)]
-							name = append(name, '(')
-							continue
-						}
-						name = name[:0]
-					}
-
-				}
-				result = append(result, r)
-			}
-			continue
-		}
-		if isName {
-			if value, ok := (*vars)[string(name)]; ok {
-				if level < 10 {
-					value = replace(value, level+1, vars)
-				}
-				result = append(result, []rune(value)...)
-				isName = false
-			} else {
-				result = append(append(result, engine.syschar), name...)
-			}
-			name = name[:0]
-		} else {
-			isName = true
-		}
+		`BR`:        Break,
+		`Link`:      Link,
+		`Tag`:       Tag,
+		`Raw`:       Raw,
+		`Component`: Component,
+		`Include`:   Include,
 	}
-	if isName {
-		result = append(append(result, engine.syschar), name...)
-	}
-	return string(result)
+	infos[`Raw`] = FuncInfo{Raw: true}
+	infos[`Component`] = FuncInfo{Min: 2, Body: true}
+	infos[`Include`] = FuncInfo{Min: 1}
 }
 
 func AddMaps(funcs *map[string]MapFunc) {
@@ -157,8 +56,29 @@ func AddFuncs(funcs *map[string]TextFunc) {
 	}
 }
 
+// Macro substitutes the variables and the functions of the input. The values of the variables which
+// have not been assigned by SetSafe are escaped.
 func Macro(input string, vars *map[string]string) string {
-	return replace(input, 0, vars)
+	return parseMacro(input).execute(0, vars, false, false)
+}
+
+// SetSafe assigns the trusted value to the variable. The trusted value is HTML which is not escaped.
+// The copy of the trusted value is kept in the reserved variable #name, see IsReserved.
+func SetSafe(vars *map[string]string, name, value string) {
+	(*vars)[name] = value
+	(*vars)[string(engine.syschar)+name] = value
+}
+
+// IsReserved returns true if the variable is used by the engine itself. The templates can't refer to
+// such variables and they must not be assigned by the request.
+func IsReserved(name string) bool {
+	return len(name) > 0 && rune(name[0]) == engine.syschar
+}
+
+// IsSafe returns true if the current value of the variable has been assigned by SetSafe
+func IsSafe(vars *map[string]string, name string) bool {
+	safe, ok := (*vars)[string(engine.syschar)+name]
+	return ok && safe == (*vars)[name]
 }
 
 func Split(input string) *[][]string {
@@ -197,220 +117,8 @@ func Split(input string) *[][]string {
 	return &ret
 }
 
-func funcProcess(name string, params [][]rune, vars *map[string]string) string {
-	if (strings.HasSuffix((*vars)[`ifs`], `0`) || strings.HasSuffix((*vars)[`ifs`], `-`)) && name != `If` && name != `IfEnd` && name != `Else` &&
-		name != `ElseIf` {
-		return ``
-	}
-	pars := make([]string, 0)
-	for _, item := range params {
-		var val string
-		ipar := strings.TrimSpace(string(item))
-		off := strings.Index(ipar, `#=`)
-		if off < 0 || off != strings.Index(ipar, `#`) {
-			val = Process(ipar, vars)
-			if val == `NULL` {
-				val = Macro(ipar, vars)
-			}
-		} else {
-			val = ipar
-		}
-		pars = append(pars, val)
-	}
-	return engine.funcs[name](vars, pars...)
-}
-
-func mapProcess(name string, params *map[string]string, vars *map[string]string) string {
-	if strings.HasSuffix((*vars)[`ifs`], `0`) || strings.HasSuffix((*vars)[`ifs`], `-`) {
-		return ``
-	}
-	pars := make(map[string]string, 0)
-	for key, item := range *params {
-		var val string
-		//		ipar := strings.TrimSpace(string(item))
-		if len(item) > 0 && item[0] != '[' {
-			val = Process(item, vars)
-			if val == `NULL` {
-				val = Macro(item, vars)
-			}
-		} else {
-			val = string(item)
-		}
-		pars[key] = val
-	}
-	return engine.maps[name](vars, &pars)
-}
-
-func Process(input string, vars *map[string]string) (out string) {
-	var (
-		isFunc, isMap, isArr int
-		params               [][]rune
-		pmap                 map[string]string
-		isKey, toLine        bool
-		pair                 rune
-	)
-	noproc := true
-	name := make([]rune, 0, 128)
-	key := make([]rune, 0, 128)
-	value := make([]rune, 0, 128)
-	forbody := make([]rune, 0, 1024)
-	for off, ch := range input {
-		if (*vars)[`for_loop`] == `1` {
-			if off+10 < len(input) && input[off:off+10] == `ForListEnd` {
-				(*vars)[`for_body`] = string(forbody)
-				forbody = forbody[:0]
-				(*vars)[`for_loop`] = `0`
-			} else {
-				forbody = append(forbody, ch)
-				continue
-			}
-		}
-		if isMap > 0 {
-			if pair > 0 {
-				if ch != pair {
-					value = append(value, ch)
-				} else {
-					pair = 0
-				}
-				continue
-			}
-			if !isKey && len(value) == 0 {
-				if ch >= '!' {
-					if ch == '"' || ch == '`' {
-						pair = ch
-					} else {
-						if ch == '[' {
-							isArr++
-						}
-						value = append(value, ch)
-					}
-				}
-				continue
-			}
-			if ch == '}' {
-				isMap--
-				//				if isFunc == 0 {
-				pmap[strings.TrimSpace(string(key))] = strings.TrimSpace(string(value))
-				out += mapProcess(string(name), &pmap, vars) //+ "\r\n"
-				name = name[:0]
-				//				}
-			}
-			if isKey {
-				if ch < '!' {
-					continue
-				}
-				if isKey && ch == ':' {
-					isKey = false
-					value = value[:0]
-					continue
-				}
-				key = append(key, ch)
-				continue
-			}
-			if isArr == 0 && (ch == 0xa || ch == ',') {
-				pmap[strings.TrimSpace(string(key))] = strings.TrimSpace(string(value))
-				isKey = true
-				key = key[:0]
-				value = value[:0]
-			}
-			if ch == '[' {
-				isArr++
-			}
-			if ch == ']' {
-				isArr--
-			}
-			value = append(value, ch)
-			continue
-		}
-		if isFunc > 0 {
-			if pair > 0 {
-				if ch != pair {
-					params[len(params)-1] = append(params[len(params)-1], ch)
-				} else {
-					pair = 0
-				}
-				continue
-			}
-			if len(params[len(params)-1]) == 0 && ch != ')' && ch != ',' && !toLine {
-				if ch >= '!' {
-					if ch == '"' || ch == '`' {
-						pair = ch
-					} else {
-						params[len(params)-1] = append(params[len(params)-1], ch)
-					}
-				}
-				continue
-			}
-			if toLine {
-				if ch == 0xa {
-					out += funcProcess(string(name), params, vars) //+ "\r\n"
-					name = name[:0]
-					isFunc = 0
-				} else {
-					params[0] = append(params[0], ch)
-				}
-			} else {
-				if ch == ')' {
-					isFunc--
-					if isFunc == 0 {
-						if string(name) == `Func` {
-							name = []rune(funcProcess(string(name), params, vars))
-						} else {
-							out += funcProcess(string(name), params, vars) //+ "\r\n"
-							name = name[:0]
-						}
-					}
-				}
-				if ch == '(' {
-					isFunc++
-				}
-				if ch == ',' && isFunc == 1 {
-					params = append(params, make([]rune, 0))
-				} else {
-					params[len(params)-1] = append(params[len(params)-1], ch)
-				}
-			}
-			continue
-		}
-		if ch == 0xa && len(out) > 0 {
-			out += "\n"
-		}
-		/*		if ch == 0xd && len(out) > 0 {
-				out += "\r"
-			}*/
-		if ch < '!' {
-			continue
-		}
-		if ch == '(' || ch == ':' {
-			if _, ok := engine.funcs[string(name)]; !ok {
-				return `NULL`
-			}
-			noproc = false
-			params = make([][]rune, 1)
-			params[0] = make([]rune, 0)
-			isFunc++
-			toLine = ch == ':'
-		} else if ch == '{' {
-			if _, ok := engine.maps[string(name)]; !ok {
-				return `NULL`
-			}
-			pmap = make(map[string]string)
-			isKey = true
-			noproc = false
-			key = key[:0]
-			isMap++
-		} else {
-			name = append(name, ch)
-			if len(name) > 64 {
-				return `NULL`
-			}
-		}
-	}
-	if toLine && isFunc > 0 {
-		out += funcProcess(string(name), params, vars) //+ "\r\n"
-	}
-	if noproc {
-		return `NULL`
-	}
-	return
+// Process executes the functions and the maps of the input. It returns NULL if the input
+// is not the list of the functions.
+func Process(input string, vars *map[string]string) string {
+	return Parse(input).Process(vars)
 }
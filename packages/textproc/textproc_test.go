@@ -127,3 +127,146 @@ func TestMap(t *testing.T) {
 		}
 	}
 }
+
+func TestParse(t *testing.T) {
+	loop := func(vars *map[string]string, pars ...string) string {
+		(*vars)[`for_loop`] = `1`
+		return ``
+	}
+	loopEnd := func(vars *map[string]string, pars ...string) (out string) {
+		for _, item := range strings.Split((*vars)[`items`], `,`) {
+			(*vars)[`item`] = item
+			out += Process((*vars)[`for_body`], vars)
+		}
+		return
+	}
+	AddFuncs(&map[string]TextFunc{`FullName`: FullName, `ForList`: loop, `ForListEnd`: loopEnd})
+	src := `FullName(#val1#, Start)
+	ForList()
+		FullName(Item, #item#)
+	ForListEnd:
+	FullName(#item#, Finish)`
+	vars[`items`] = `a,b`
+	for i := 0; i < 2; i++ {
+		if get := Process(src, &vars); get != "строка 1 Start\nItem a\nItem b\nb Finish" {
+			t.Errorf(`wrong result %q`, get)
+		}
+	}
+	AddFuncs(&map[string]TextFunc{`FullName`: AsIs})
+	if get := Process(src, &vars); get != "строка 1\nItem\nItem\nb" {
+		t.Errorf(`wrong result %q`, get)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	empty := func(vars *map[string]string, pars ...string) string {
+		return ``
+	}
+	AddFuncs(&map[string]TextFunc{`FullName`: FullName, `Cond`: empty, `CondEnd`: empty, `Otherwise`: empty})
+	AddMaps(&map[string]MapFunc{`Map1`: Map1})
+	AddInfo(&map[string]FuncInfo{`FullName`: {Min: 2, Max: 3}, `Map1`: {Keys: []string{`href`}},
+		`Cond`: {Min: 1, End: `CondEnd`, Inline: 1}, `Otherwise`: {Parent: `Cond`}})
+	input := []TestText{
+		{`FullName(a, b)
+		Cond(#val1#)
+			FullName(a, Cond(#val1#, b, c))
+		Otherwise:
+			Map1{href: http://google.com, Name: "#FullName(x, y)"}
+		CondEnd:`, ``},
+		{`FullName(a)
+	Map1{Name: test}`, `1:1: FullName has 1 parameters, expected 2-3;2:2: Map1 has no href parameter`},
+		{`Cond(1)
+	Otherwise:
+CondEnd:
+Otherwise:
+CondEnd:`, `4:1: Otherwise is outside of Cond;5:1: CondEnd without Cond`},
+		{`Cond(1)
+	FullName(a, b, #Unknown(x)) Test(x)`, `2:18: unknown function Unknown;2:30: unknown function Test;1:1: Cond is not closed by CondEnd`},
+		{`FullName(a, "b",
+	Map1{href: #val1#`, `1:1: unclosed bracket of FullName`},
+		{`Map1{href: #val1#`, `1:1: unterminated map Map1`},
+		{`text`, `1:1: unexpected text text`},
+	}
+	for _, item := range input {
+		var list []string
+		for _, err := range Validate(item.src) {
+			list = append(list, err.Error())
+		}
+		if get := strings.Join(list, `;`); get != item.want {
+			t.Errorf(`wrong result %s != %s`, get, item.want)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	AddFuncs(&map[string]TextFunc{`AsIs`: AsIs, `Data`: AsIs})
+	AddInfo(&map[string]FuncInfo{`Data`: {Raw: true, Text: true}})
+	vars := map[string]string{`name`: `<b>Bob</b>`, `ref`: `#name# & co`, `call`: `<Tag(b, x)>`}
+	SetSafe(&vars, `html`, `<i>#name#</i>`)
+	input := []TestText{
+		{`#name#`, `&lt;b&gt;Bob&lt;/b&gt;`},
+		{`#ref#`, `&lt;b&gt;Bob&lt;/b&gt; &amp; co`},
+		{`#html#`, `<i>&lt;b&gt;Bob&lt;/b&gt;</i>`},
+		{`#call#`, `&lt;Tag(b, x)&gt;`},
+		{`#Tag(p, #name#)`, `<p>&lt;b&gt;Bob&lt;/b&gt;</p>`},
+		{`#Raw(#name#)`, `<b>Bob</b>`},
+		{`#Tag(p, Data(#name#))`, `<p>&lt;b&gt;Bob&lt;/b&gt;</p>`},
+		{`#Raw(Data(#name#))`, `<b>Bob</b>`},
+	}
+	for _, item := range input {
+		if get := Macro(item.src, &vars); get != item.want {
+			t.Errorf(`wrong result %s != %s`, get, item.want)
+		}
+	}
+	vars[`html`] = `<i>changed</i>`
+	if get := Macro(`#html#`, &vars); get != `&lt;i&gt;changed&lt;/i&gt;` {
+		t.Errorf(`wrong result %s`, get)
+	}
+	for name := range vars {
+		if IsReserved(name) != (name == `#html`) {
+			t.Errorf(`wrong reserved variable %s`, name)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	pages := map[string]string{
+		`header`: `Tag(h1, #title#)`,
+		`self`:   `Include(self)`,
+		`lib`:    "Component(Item, name, `Tag(li, #name#)`)",
+	}
+	SetLoader(func(vars *map[string]string, name string) (*Program, error) {
+		if src, ok := pages[name]; ok {
+			return Parse(src), nil
+		}
+		return nil, nil
+	})
+	defer SetLoader(nil)
+	vars := map[string]string{`title`: `Main`}
+	input := []TestText{
+		{`Include(header, title=Welcome)`, `<h1>Welcome</h1>`},
+		{`Include(header)`, `<h1>Main</h1>`},
+		{"Component(Card, title, text, `Tag(b, #title#)Tag(i, #text#)`) Include(Card, text=Text)", `<b></b><i>Text</i>`},
+		{`Include(lib) Include(Item, name=One) Include(Item, name=Two)`, `<li>One</li><li>Two</li>`},
+		{`Include(unknown)`, ``},
+		{`Include(self)`, `Include self: too many nested includes`},
+		{`Include(header, title=<b>) Tag(p, #title#)`, `<h1><b></h1><p>Main</p>`},
+	}
+	for _, item := range input {
+		if get := Process(item.src, &vars); get != item.want {
+			t.Errorf(`wrong result %s != %s`, get, item.want)
+		}
+	}
+	if _, ok := vars[`text`]; ok || vars[includeVar] != `0` || vars[`title`] != `Main` {
+		t.Errorf(`the variables have not been restored %v`, vars)
+	}
+	// the variables of the request can't replace the components or change the depth
+	vars[`component_header`] = `Tag(p, Replaced)`
+	vars[`include`] = `100`
+	if get := Process(`Include(header)`, &vars); get != `<h1>Main</h1>` {
+		t.Errorf(`wrong result %s`, get)
+	}
+	if !IsReserved(includeVar) || !IsReserved(componentVar+`Card`) {
+		t.Errorf(`the variables of Include are not reserved`)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package textproc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// FuncInfo describes the parameters of the function or the map for the validation and the escaping
+type FuncInfo struct {
+	Min    int      // the minimum count of the parameters
+	Max    int      // the maximum count of the parameters, 0 means any count
+	Keys   []string // the required keys of the map
+	End    string   // the function starts the block which must be closed by End function
+	Inline int      // the function with more than Inline parameters doesn't start the block
+	Parent string   // the function can be used only inside the block started by Parent function
+	Raw    bool     // the variables are substituted into the parameters without the escaping
+	Text   bool     // the result is the plain text which is escaped in HTML
+	Body   bool     // the last parameter is passed as the source without processing
+}
+
+// SyntaxError is the error of the source of the template
+type SyntaxError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+var (
+	infos = make(map[string]FuncInfo)
+	// the name of the function after # inside the text
+	reMacroFunc = regexp.MustCompile(`#([A-Za-z]\w*)([#({])`)
+)
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf(`%d:%d: %s`, e.Line, e.Column, e.Message)
+}
+
+// AddInfo appends the descriptions of the parameters of the functions
+func AddInfo(list *map[string]FuncInfo) {
+	for key, info := range *list {
+		infos[key] = info
+	}
+}
+
+type validator struct {
+	src  string
+	errs []*SyntaxError
+}
+
+type block struct {
+	name string
+	pos  int
+}
+
+func (v *validator) errorf(pos int, format string, args ...interface{}) {
+	line := strings.Count(v.src[:pos], "\n") + 1
+	column := utf8.RuneCountInString(v.src[strings.LastIndex(v.src[:pos], "\n")+1:pos]) + 1
+	v.errs = append(v.errs, &SyntaxError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) params(name string, base, pos, count int) {
+	info, ok := infos[name]
+	if !ok {
+		return
+	}
+	if count < info.Min || (info.Max > 0 && count > info.Max) {
+		expect := fmt.Sprintf(`%d`, info.Min)
+		if info.Max > info.Min {
+			expect = fmt.Sprintf(`%d-%d`, info.Min, info.Max)
+		} else if info.Max == 0 {
+			expect = fmt.Sprintf(`at least %d`, info.Min)
+		}
+		v.errorf(base+pos, `%s has %d parameters, expected %s`, name, count, expect)
+	}
+}
+
+func (v *validator) param(par *param, base int) {
+	if par.asis {
+		return
+	}
+	if !par.prog.null {
+		v.program(par.prog, base+par.pos, false)
+	} else {
+		v.macro(par.raw, base+par.pos)
+	}
+}
+
+func (v *validator) call(item node, base int) {
+	switch n := item.(type) {
+	case *funcNode:
+		v.params(n.name, base, n.pos, len(n.params))
+		for _, par := range n.params {
+			v.param(par, base)
+		}
+	case *mapNode:
+		v.params(n.name, base, n.pos, len(n.params))
+		for _, key := range infos[n.name].Keys {
+			if _, ok := n.params[key]; !ok {
+				v.errorf(base+n.pos, `%s has no %s parameter`, n.name, key)
+			}
+		}
+		for _, par := range n.params {
+			v.param(par, base)
+		}
+	}
+}
+
+// program checks the functions and the blocks of the program. The source of the template must
+// consist of the functions only.
+func (v *validator) program(prog *Program, base int, strict bool) {
+	var blocks []block
+	ends := make(map[string]string)
+	for name, info := range infos {
+		if len(info.End) > 0 {
+			ends[info.End] = name
+		}
+	}
+	for _, item := range prog.nodes {
+		v.call(item, base)
+		fnode, ok := item.(*funcNode)
+		if !ok {
+			continue
+		}
+		info := infos[fnode.name]
+		if len(info.Parent) > 0 && (len(blocks) == 0 || blocks[len(blocks)-1].name != info.Parent) {
+			v.errorf(base+fnode.pos, `%s is outside of %s`, fnode.name, info.Parent)
+		}
+		if len(info.End) > 0 && (info.Inline == 0 || len(fnode.params) <= info.Inline) {
+			blocks = append(blocks, block{fnode.name, base + fnode.pos})
+		}
+		if begin, ok := ends[fnode.name]; ok {
+			if len(blocks) == 0 || blocks[len(blocks)-1].name != begin {
+				v.errorf(base+fnode.pos, `%s without %s`, fnode.name, begin)
+			} else {
+				blocks = blocks[:len(blocks)-1]
+			}
+		}
+	}
+	if len(prog.err) > 0 && strict {
+		v.errorf(base+prog.errPos, `%s`, prog.err)
+	} else if strict && prog.null && len(strings.TrimSpace(prog.src)) > 0 {
+		v.errorf(base, `there are no functions`)
+	}
+	for _, item := range blocks {
+		v.errorf(item.pos, `%s is not closed by %s`, item.name, infos[item.name].End)
+	}
+}
+
+// macro checks the functions which are called inside the text like #Func(...)
+func (v *validator) macro(input string, base int) {
+	for off := 0; off < len(input); {
+		loc := reMacroFunc.FindStringSubmatchIndex(input[off:])
+		if loc == nil {
+			break
+		}
+		name := input[off+loc[2] : off+loc[3]]
+		start := off + loc[2]
+		off += loc[1]
+		if input[off-1] == '#' {
+			continue
+		}
+		if input[off-1] == '(' {
+			_, ok := engine.funcs[name]
+			if !ok {
+				v.errorf(base+start, `unknown function %s`, name)
+				continue
+			}
+		} else if _, ok := engine.maps[name]; !ok {
+			v.errorf(base+start, `unknown map %s`, name)
+			continue
+		}
+		prog := parseProgram(input[start:], true)
+		if len(prog.nodes) == 0 {
+			v.errorf(base+start+prog.errPos, `%s`, prog.err)
+			break
+		}
+		v.call(prog.nodes[0], base+start)
+		switch n := prog.nodes[0].(type) {
+		case *funcNode:
+			off = start + n.tail.next
+		case *mapNode:
+			off = start + n.tail.next
+		}
+	}
+}
+
+// Validate checks the syntax of the template and returns the list of the errors.
+func Validate(input string) []*SyntaxError {
+	return parseProgram(input, true).Validate()
+}
+
+// Validate checks the syntax of the parsed template and returns the list of the errors.
+func (prog *Program) Validate() []*SyntaxError {
+	v := validator{src: prog.src}
+	v.program(prog, 0, true)
+	return v.errs
+}
@@ -0,0 +1,213 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+)
+
+const (
+	// PEERS_MAX_SIZE is the maximum size of the answer to DATA_TYPE_PEERS
+	PEERS_MAX_SIZE = consts.PEERS_COUNT * 101
+)
+
+var peerHostRe = regexp.MustCompile(`^[0-9a-zA-Z\.\-_]{1,100}$`)
+
+// PeerHost returns the host without the port. The address book stores the hosts in the same way as full_nodes.
+func PeerHost(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		return name
+	}
+	return host
+}
+
+// ValidPeerHost returns true if the host can be added to the address book
+func ValidPeerHost(host string) bool {
+	if !peerHostRe.MatchString(host) {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsUnspecified()) {
+		return false
+	}
+	return host != `localhost`
+}
+
+// ProtocolError is returned if the node has sent the invalid data. Only these errors increase the ban score,
+// the connection errors don't.
+type ProtocolError struct {
+	Host   string
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf(`%s: %s`, e.Host, e.Reason)
+}
+
+// AddPeers adds the unknown hosts which have been received from the source node to the address book.
+// The source can add no more than PEERS_SOURCE_MAX hosts which we have never connected to, the empty source
+// isn't limited. If the address book has PEERS_MAX hosts, the host which we have never connected to
+// is removed first, then the host which we have not connected to for the longest time.
+func (db *DCDB) AddPeers(source string, hosts []string) error {
+	count, err := db.Single(`SELECT count(*) FROM peers`).Int64()
+	if err != nil {
+		return ErrInfo(err)
+	}
+	source = PeerHost(source)
+	var added int64
+	if len(source) > 0 {
+		if added, err = db.Single(`SELECT count(*) FROM peers WHERE source = ? AND last_seen = 0`,
+			source).Int64(); err != nil {
+			return ErrInfo(err)
+		}
+	}
+	for _, host := range hosts {
+		if len(source) > 0 && added >= consts.PEERS_SOURCE_MAX {
+			break
+		}
+		host = PeerHost(host)
+		if !ValidPeerHost(host) {
+			continue
+		}
+		exists, err := db.Single(`SELECT count(*) FROM peers WHERE host = ?`, host).Int64()
+		if err != nil {
+			return ErrInfo(err)
+		}
+		if exists > 0 {
+			continue
+		}
+		if count >= consts.PEERS_MAX {
+			// the banned hosts are kept, otherwise they would be added again
+			evicted, err := db.ExecSqlGetAffect(`DELETE FROM peers WHERE host = (SELECT host FROM peers
+				WHERE ban_score = 0 ORDER BY last_seen LIMIT 1)`)
+			if err != nil {
+				return ErrInfo(err)
+			}
+			if evicted == 0 {
+				break
+			}
+			count--
+		}
+		if err = db.ExecSql(`INSERT INTO peers (host, source) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+			host, source); err != nil {
+			return ErrInfo(err)
+		}
+		count++
+		added++
+	}
+	return nil
+}
+
+// PeerSeen stores the time of the successful connection with the host and the latency of the handshake
+func (db *DCDB) PeerSeen(host string, latency time.Duration, blockId int64) error {
+	host = PeerHost(host)
+	if !ValidPeerHost(host) {
+		return nil
+	}
+	return db.ExecSql(`INSERT INTO peers (host, last_seen, latency, block_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (host) DO UPDATE SET last_seen = EXCLUDED.last_seen, latency = EXCLUDED.latency,
+		block_id = EXCLUDED.block_id`, host, Time(), int64(latency/time.Millisecond), blockId)
+}
+
+// NodesBan increases the ban score of the host which has sent the invalid data. The host is not used
+// when its score reaches MAX_BAN_SCORE.
+func (db *DCDB) NodesBan(host, info string) error {
+	host = PeerHost(host)
+	log.Error("ban %s: %s", host, info)
+	if len(host) == 0 {
+		return nil
+	}
+	return db.ExecSql(`INSERT INTO peers (host, ban_score, ban_time) VALUES (?, ?, ?)
+		ON CONFLICT (host) DO UPDATE SET ban_score = peers.ban_score + EXCLUDED.ban_score,
+		ban_time = EXCLUDED.ban_time`, host, consts.BAN_SCORE, Time())
+}
+
+// PeerFailed removes the host from the address book if we have not connected to it for PEERS_EXPIRE seconds.
+// The banned hosts are kept until their ban_score is decreased.
+func (db *DCDB) PeerFailed(host string) error {
+	return db.ExecSql(`DELETE FROM peers WHERE host = ? AND last_seen < ? AND ban_score = 0`, PeerHost(host),
+		Time()-consts.PEERS_EXPIRE)
+}
+
+// DecreaseBanScores is called every PEERS_PERIOD seconds so the banned hosts are used again after a while
+func (db *DCDB) DecreaseBanScores() error {
+	return db.ExecSql(`UPDATE peers SET ban_score = ban_score - 1 WHERE ban_score > 0`)
+}
+
+// GetNewPeers returns the hosts of the address book which we have never connected to
+func (db *DCDB) GetNewPeers(count int) ([]string, error) {
+	return db.GetList(fmt.Sprintf(`SELECT host FROM peers WHERE last_seen = 0 AND ban_score < ?
+		ORDER BY ban_score LIMIT %d`, count), consts.MAX_BAN_SCORE).String()
+}
+
+// RequestPeers sends our host to the node and returns the hosts from its address book
+func RequestPeers(host string) ([]string, error) {
+	conn, err := TcpRequest(host, consts.DATA_TYPE_PEERS)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = WriteSizeAndData(EncodeLengthPlusData(*TcpHost), conn); err != nil {
+		return nil, ErrInfo(err)
+	}
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return nil, ErrInfo(err)
+	}
+	size := BinToDec(buf)
+	if size == 0 || size > PEERS_MAX_SIZE {
+		return nil, &ProtocolError{host, fmt.Sprintf(`incorrect size of peers %d`, size)}
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(conn, data); err != nil {
+		return nil, ErrInfo(err)
+	}
+	return DecodePeers(data), nil
+}
+
+// EncodePeers returns the list of the hosts in the format of the answer to DATA_TYPE_PEERS
+func EncodePeers(hosts []string) []byte {
+	data := DecToBin(len(hosts), 1)
+	for _, host := range hosts {
+		data = append(data, EncodeLengthPlusData(host)...)
+	}
+	return data
+}
+
+// DecodePeers parses the answer to DATA_TYPE_PEERS and skips the invalid hosts
+func DecodePeers(data []byte) []string {
+	hosts := make([]string, 0)
+	if len(data) == 0 {
+		return hosts
+	}
+	count := BinToDecBytesShift(&data, 1)
+	for i := int64(0); i < count && len(data) > 0; i++ {
+		size := DecodeLength(&data)
+		if int64(len(data)) < size {
+			break
+		}
+		if host := string(BytesShift(&data, size)); ValidPeerHost(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
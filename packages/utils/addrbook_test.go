@@ -0,0 +1,35 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestPeers(t *testing.T) {
+	hosts := []string{`192.168.1.5`, `127.0.0.1`, `node.example.com`, `bad host`, `10.0.0.1:7078`}
+	list := DecodePeers(EncodePeers(hosts))
+	if len(list) != 2 || list[0] != `192.168.1.5` || list[1] != `node.example.com` {
+		t.Errorf(`wrong peers %v`, list)
+	}
+	if list = DecodePeers(EncodePeers(hosts)[:5]); len(list) != 0 {
+		t.Errorf(`the short data has been parsed %v`, list)
+	}
+	if host := PeerHost(`10.0.0.1:7078`); host != `10.0.0.1` {
+		t.Errorf(`wrong host %s`, host)
+	}
+}
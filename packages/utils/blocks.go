@@ -0,0 +1,112 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+)
+
+// errStopped is returned when the download has been stopped by the caller
+var errStopped = errors.New(`download has been stopped`)
+
+// BlockBody is the block which has been downloaded by DownloadBlocks. Err is not nil if the download has failed.
+type BlockBody struct {
+	Data []byte
+	Err  error
+}
+
+// DownloadBlocks downloads the blocks [from, to] from the host in the background. The blocks are sent
+// to the returned channel in order as they arrive, the next batch is requested while the previous blocks
+// are being processed. The channel is closed after the last block or the error.
+// The download is stopped when stop is closed.
+func DownloadBlocks(host string, from, to int64, stop <-chan bool) <-chan BlockBody {
+	ch := make(chan BlockBody, consts.BLOCKS_PIPELINE)
+	send := func(block BlockBody) bool {
+		select {
+		case ch <- block:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	go func() {
+		defer close(ch)
+		for from <= to {
+			conn, err := TcpRequest(host, consts.DATA_TYPE_BLOCKS)
+			if _, ok := err.(*NotSupportedError); ok {
+				// старые ноды отдают только по одному блоку за запрос
+				data, err := GetBlockBody(host, from, consts.DATA_TYPE_BLOCK_BODY)
+				if !send(BlockBody{data, err}) || err != nil {
+					return
+				}
+				from++
+				continue
+			}
+			if err != nil {
+				send(BlockBody{Err: err})
+				return
+			}
+			count, err := readBlocks(conn, from, to, send)
+			conn.Close()
+			if err == nil && count == 0 {
+				err = ErrInfo("null block")
+			}
+			if err != nil {
+				if err != errStopped {
+					send(BlockBody{Err: err})
+				}
+				return
+			}
+			from += count
+		}
+	}()
+	return ch
+}
+
+// readBlocks requests the blocks [from, to] and passes them to send. It returns the count of the received blocks.
+func readBlocks(conn net.Conn, from, to int64, send func(BlockBody) bool) (int64, error) {
+	var count int64
+	_, err := conn.Write(append(DecToBin(from, 4), DecToBin(to, 4)...))
+	if err != nil {
+		return 0, ErrInfo(err)
+	}
+	buf := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(conn, buf); err != nil {
+			return count, ErrInfo(err)
+		}
+		size := BinToDec(buf)
+		if size == 0 {
+			return count, nil
+		}
+		if size > consts.MAX_BLOCK_SIZE {
+			return count, ErrInfo("incorrect size")
+		}
+		data := make([]byte, size)
+		if _, err = io.ReadFull(conn, data); err != nil {
+			return count, ErrInfo(err)
+		}
+		if !send(BlockBody{Data: data}) {
+			return count, errStopped
+		}
+		count++
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/lib"
+)
+
+const (
+	// HANDSHAKE_MAX_SIZE is the maximum size of the handshake message
+	HANDSHAKE_MAX_SIZE = 4096
+)
+
+// DataTypes are the types of the requests which are handled by tcpserver
+var DataTypes = []int64{1, 2, 4, consts.DATA_TYPE_BLOCK_BODY, consts.DATA_TYPE_MAX_BLOCK_ID, consts.DATA_TYPE_BLOCKS,
+	consts.DATA_TYPE_PEERS, consts.DATA_TYPE_MUX}
+
+// LegacyDataTypes are the types of the requests which are handled by the nodes without the handshake
+var LegacyDataTypes = []int64{1, 2, 4, consts.DATA_TYPE_BLOCK_BODY, consts.DATA_TYPE_MAX_BLOCK_ID}
+
+// errNoHandshake is returned by tcpHandshake if the node has closed the connection without the answer.
+// The old node does it when it gets the unknown type of the request.
+var errNoHandshake = errors.New(`handshake is not supported`)
+
+// NotSupportedError is returned by TcpRequest if the node doesn't handle the type of the request
+type NotSupportedError struct {
+	DataType int64
+	Host     string
+}
+
+func (e *NotSupportedError) Error() string {
+	return fmt.Sprintf(`data type %d is not supported by %s`, e.DataType, e.Host)
+}
+
+// Handshake is the first message of the TCP connection between the nodes. Both sides send it
+// and check the version of the protocol and the signature of the node key. FullNodeId is not sent,
+// it is set by Authenticate if the key belongs to the full node.
+type Handshake struct {
+	Version    int64
+	MinVersion int64
+	Time       int64
+	BlockId    int64
+	Types      []int64
+	PublicKey  []byte
+	Sign       []byte
+	FullNodeId int64
+}
+
+func (h *Handshake) forSign() string {
+	types := make([]string, len(h.Types))
+	for i, item := range h.Types {
+		types[i] = Int64ToStr(item)
+	}
+	return fmt.Sprintf("%d,%d,%d,%d,%s,%x", h.Version, h.MinVersion, h.Time, h.BlockId,
+		strings.Join(types, `;`), h.PublicKey)
+}
+
+// Bytes returns the binary representation of the handshake
+func (h *Handshake) Bytes() []byte {
+	data := DecToBin(h.Version, 2)
+	data = append(data, DecToBin(h.MinVersion, 2)...)
+	data = append(data, DecToBin(h.Time, 4)...)
+	data = append(data, DecToBin(h.BlockId, 4)...)
+	data = append(data, DecToBin(len(h.Types), 1)...)
+	for _, item := range h.Types {
+		data = append(data, DecToBin(item, 2)...)
+	}
+	data = append(data, EncodeLengthPlusData(h.PublicKey)...)
+	return append(data, EncodeLengthPlusData(h.Sign)...)
+}
+
+// Supports returns true if the node handles the specified type of the request
+func (h *Handshake) Supports(dataType int64) bool {
+	for _, item := range h.Types {
+		if item == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+// Signed returns true if the handshake is signed with the node key
+func (h *Handshake) Signed() bool {
+	return len(h.Sign) > 0
+}
+
+// Check returns the reason why the handshake of the other node is not accepted. The handshake
+// must be signed with the node key.
+func (h *Handshake) Check() error {
+	if h.Version < consts.MIN_PROTOCOL_VERSION {
+		return fmt.Errorf(`protocol version %d is older than %d`, h.Version, consts.MIN_PROTOCOL_VERSION)
+	}
+	if h.MinVersion > consts.PROTOCOL_VERSION {
+		return fmt.Errorf(`protocol version %d is required, we have %d`, h.MinVersion, consts.PROTOCOL_VERSION)
+	}
+	if dif := time.Now().Unix() - h.Time; dif > consts.HANDSHAKE_PERIOD || dif < -consts.HANDSHAKE_PERIOD {
+		return fmt.Errorf(`invalid time %d`, h.Time)
+	}
+	if len(h.PublicKey) == 0 || len(h.Sign) == 0 {
+		return fmt.Errorf(`node key or sign is not specified`)
+	}
+	if ok, err := CheckSign([][]byte{h.PublicKey}, h.forSign(), h.Sign, true); !ok || err != nil {
+		return fmt.Errorf(`invalid sign of node key %x`, h.PublicKey)
+	}
+	return nil
+}
+
+// ParseHandshake decodes the handshake from the binary data
+func ParseHandshake(data []byte) (*Handshake, error) {
+	if len(data) < 13 {
+		return nil, fmt.Errorf(`handshake is too short`)
+	}
+	h := Handshake{Version: BinToDecBytesShift(&data, 2), MinVersion: BinToDecBytesShift(&data, 2),
+		Time: BinToDecBytesShift(&data, 4), BlockId: BinToDecBytesShift(&data, 4)}
+	count := BinToDecBytesShift(&data, 1)
+	if int64(len(data)) < count*2 {
+		return nil, fmt.Errorf(`handshake is too short`)
+	}
+	for i := int64(0); i < count; i++ {
+		h.Types = append(h.Types, BinToDecBytesShift(&data, 2))
+	}
+	for _, field := range []*[]byte{&h.PublicKey, &h.Sign} {
+		size := DecodeLength(&data)
+		if int64(len(data)) < size {
+			return nil, fmt.Errorf(`handshake is too short`)
+		}
+		*field = BytesShift(&data, size)
+	}
+	return &h, nil
+}
+
+// Authenticate sets FullNodeId if the handshake is signed with the node key of the full node.
+// Otherwise, it returns the reason why the node is not accepted.
+func (db *DCDB) Authenticate(h *Handshake) error {
+	if !h.Signed() {
+		return fmt.Errorf(`handshake is not signed`)
+	}
+	id, err := db.Single(`SELECT f.id FROM full_nodes f
+		LEFT JOIN dlt_wallets w ON f.wallet_id > 0 AND w.wallet_id = f.wallet_id
+		LEFT JOIN system_recognized_states s ON f.wallet_id = 0 AND s.state_id = f.state_id
+		WHERE w.node_public_key = [hex] OR s.node_public_key = [hex] LIMIT 1`,
+		BinToHex(h.PublicKey), BinToHex(h.PublicKey)).Int64()
+	if err != nil {
+		log.Error("%v", ErrInfo(err))
+		return fmt.Errorf(`node key can't be checked`)
+	}
+	if id == 0 {
+		return fmt.Errorf(`node key %x doesn't belong to any full node`, h.PublicKey)
+	}
+	h.FullNodeId = id
+	return nil
+}
+
+// NewHandshake returns the handshake of the current node. It is signed if the node has the key.
+func (db *DCDB) NewHandshake() (*Handshake, error) {
+	blockId, err := db.GetBlockId()
+	if err != nil {
+		return nil, ErrInfo(err)
+	}
+	privateKey, err := db.GetNodePrivateKey()
+	if err != nil {
+		return nil, ErrInfo(err)
+	}
+	h := Handshake{Version: consts.PROTOCOL_VERSION, MinVersion: consts.MIN_PROTOCOL_VERSION,
+		Time: time.Now().Unix(), BlockId: blockId, Types: DataTypes}
+	if len(privateKey) > 0 {
+		publicKey, err := db.GetMyNodePublicKey(``)
+		if err != nil {
+			return nil, ErrInfo(err)
+		}
+		h.PublicKey = []byte(publicKey)
+		if h.Sign, err = lib.SignECDSA(privateKey, h.forSign()); err != nil {
+			return nil, ErrInfo(err)
+		}
+	}
+	return &h, nil
+}
+
+// peers are the persistent connections to the other nodes
+var peers = struct {
+	sync.Mutex
+	list map[string]*peer
+}{list: make(map[string]*peer)}
+
+type peer struct {
+	sync.Mutex
+	mux *MuxConn
+	// legacy is the time when the node has closed the connection after our handshake
+	legacy int64
+}
+
+// peerConn returns the persistent connection to the host. If the host doesn't support the multiplexing
+// it returns the new connection with the finished handshake. If the host doesn't support the handshake
+// it returns the new connection without it and the handshake with LegacyDataTypes.
+func peerConn(host string) (*MuxConn, net.Conn, *Handshake, error) {
+	peers.Lock()
+	item, ok := peers.list[host]
+	if !ok {
+		item = &peer{}
+		peers.list[host] = item
+	}
+	peers.Unlock()
+
+	item.Lock()
+	defer item.Unlock()
+	if item.mux != nil && !item.mux.Closed() {
+		return item.mux, nil, item.mux.Peer, nil
+	}
+	conn, err := TcpConn(host)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if consts.LEGACY_TCP && time.Now().Unix()-item.legacy < consts.HANDSHAKE_PERIOD {
+		return nil, conn, &Handshake{Types: LegacyDataTypes}, nil
+	}
+	start := time.Now()
+	hs, err := tcpHandshake(conn)
+	if err == errNoHandshake && consts.LEGACY_TCP {
+		conn.Close()
+		item.legacy = time.Now().Unix()
+		if conn, err = TcpConn(host); err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, conn, &Handshake{Types: LegacyDataTypes}, nil
+	}
+	if err != nil {
+		conn.Close()
+		log.Error("handshake with %s: %v", host, err)
+		return nil, nil, nil, err
+	}
+	if err = DB.Authenticate(hs); err != nil {
+		conn.Close()
+		log.Error("handshake with %s: %v", host, err)
+		return nil, nil, nil, err
+	}
+	if err = DB.PeerSeen(host, time.Since(start), hs.BlockId); err != nil {
+		log.Error("%v", ErrInfo(err))
+	}
+	if !hs.Supports(consts.DATA_TYPE_MUX) {
+		return nil, conn, hs, nil
+	}
+	if _, err = conn.Write(DecToBin(consts.DATA_TYPE_MUX, 2)); err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	item.mux = NewMuxConn(conn, hs)
+	go func(mux *MuxConn) {
+		err := mux.Serve(nil)
+		log.Debug("connection with %s is closed: %v", host, err)
+	}(item.mux)
+	go item.mux.KeepAlive()
+	return item.mux, nil, hs, nil
+}
+
+// TcpRequest sends the type of the request to the node and returns the connection for the request.
+// The request uses the persistent connection with the node if the node supports it.
+// The caller must close the returned connection.
+func TcpRequest(host string, dataType int64) (net.Conn, error) {
+	mux, conn, hs, err := peerConn(host)
+	if _, ok := err.(*ProtocolError); ok {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrInfo(err)
+	}
+	if !hs.Supports(dataType) {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, &NotSupportedError{dataType, host}
+	}
+	if mux != nil {
+		stream, err := mux.Open(dataType)
+		if err != nil {
+			return nil, ErrInfo(err)
+		}
+		return stream, nil
+	}
+	if _, err = conn.Write(DecToBin(dataType, 2)); err != nil {
+		conn.Close()
+		return nil, ErrInfo(err)
+	}
+	return conn, nil
+}
+
+func tcpHandshake(conn net.Conn) (*Handshake, error) {
+	my, err := DB.NewHandshake()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(DecToBin(consts.DATA_TYPE_HANDSHAKE, 2)); err != nil {
+		return nil, err
+	}
+	if err = WriteSizeAndData(my.Bytes(), conn); err != nil {
+		return nil, err
+	}
+	status := make([]byte, 1)
+	if _, err = conn.Read(status); err != nil {
+		// старый нод закрывает соединение, получив неизвестный ему тип данных.
+		// остальные ошибки (таймаут, сброс соединения) не означают, что нод старый
+		if err == io.EOF {
+			log.Debug("handshake: %v", err)
+			return nil, errNoHandshake
+		}
+		return nil, err
+	}
+	data, err := TCPGetSizeAndData(conn, HANDSHAKE_MAX_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	if status[0] == 0 {
+		return nil, fmt.Errorf(`refused: %s`, data)
+	}
+	peer, err := ParseHandshake(data)
+	if err == nil {
+		err = peer.Check()
+	}
+	if err != nil {
+		return nil, &ProtocolError{conn.RemoteAddr().String(), err.Error()}
+	}
+	return peer, nil
+}
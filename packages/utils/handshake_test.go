@@ -0,0 +1,67 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/lib"
+)
+
+func TestHandshake(t *testing.T) {
+	priv, pub := lib.GenKeys()
+	publicKey, _ := hex.DecodeString(pub)
+	h := Handshake{Version: consts.PROTOCOL_VERSION, MinVersion: consts.MIN_PROTOCOL_VERSION, Time: time.Now().Unix(),
+		BlockId: 77, Types: DataTypes, PublicKey: publicKey}
+	h.Sign, _ = lib.SignECDSA(priv, h.forSign())
+	peer, err := ParseHandshake(h.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = peer.Check(); err != nil || peer.BlockId != 77 || !peer.Supports(consts.DATA_TYPE_BLOCK_BODY) {
+		t.Errorf(`wrong handshake %v %v`, peer, err)
+	}
+	peer.BlockId++
+	if err = peer.Check(); err == nil {
+		t.Errorf(`the changed handshake has been accepted`)
+	}
+	peer.BlockId--
+	peer.MinVersion = consts.PROTOCOL_VERSION + 1
+	if err = peer.Check(); err == nil {
+		t.Errorf(`the incompatible version has been accepted`)
+	}
+	if _, err = ParseHandshake(h.Bytes()[:20]); err == nil {
+		t.Errorf(`the short handshake has been parsed`)
+	}
+
+	// the node without the key sends the handshake without the sign, it is refused
+	observer := h
+	observer.PublicKey, observer.Sign = nil, nil
+	if peer, err = ParseHandshake(observer.Bytes()); err != nil || peer.Signed() {
+		t.Fatalf(`wrong observer handshake %v %v`, peer, err)
+	}
+	if err = peer.Check(); err == nil {
+		t.Errorf(`the unsigned handshake has been accepted`)
+	}
+	peer.PublicKey = publicKey
+	if err = peer.Check(); err == nil {
+		t.Errorf(`the node key without the sign has been accepted`)
+	}
+}
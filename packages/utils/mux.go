@@ -0,0 +1,348 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+)
+
+const (
+	// FRAME_CHUNK is the maximum size of the data in one frame
+	FRAME_CHUNK = 65536
+	// FRAME_HEADER is the size of the header of the frame: stream id (4 bytes), kind (1 byte), size (4 bytes)
+	FRAME_HEADER = 9
+	// STREAM_BUFFER is the maximum size of the data which have been received by the stream but have not been
+	// read yet. It is used only by our requests which download the blocks. The largest answer is the batch
+	// of the blocks of DATA_TYPE_BLOCKS.
+	STREAM_BUFFER = consts.BLOCKS_BATCH_SIZE + consts.MAX_BLOCK_SIZE + FRAME_CHUNK
+	// REQUEST_BUFFER is the same limit for the requests from the other node and for our other requests.
+	// The handlers read the data while it is coming, so it doesn't limit the size of the request.
+	REQUEST_BUFFER = 16 * FRAME_CHUNK
+)
+
+// the kinds of the frames
+const (
+	frameOpen = iota + 1 // the data is the type of the request
+	frameData
+	frameClose
+	framePing
+	framePong
+)
+
+// MuxConn is the TCP connection between the nodes which carries several concurrent requests.
+// Every request is the Stream with its own identifier.
+type MuxConn struct {
+	conn      net.Conn
+	wmutex    sync.Mutex
+	mutex     sync.Mutex
+	streams   map[uint32]*Stream
+	nextId    uint32
+	limit     chan bool
+	done      chan bool
+	closeOnce sync.Once
+	Peer      *Handshake
+}
+
+// Stream is the request inside MuxConn. It implements net.Conn so the handlers of the requests
+// work with it as with the usual TCP connection.
+type Stream struct {
+	id        uint32
+	mux       *MuxConn
+	mutex     sync.Mutex
+	buf       []byte
+	limit     int // the maximum size of buf
+	eof       bool
+	err       error
+	deadline  time.Time
+	notify    chan bool
+	closeOnce sync.Once
+}
+
+// NewMuxConn returns MuxConn for the connection with the finished handshake
+func NewMuxConn(conn net.Conn, peer *Handshake) *MuxConn {
+	conn.SetDeadline(time.Time{})
+	return &MuxConn{conn: conn, streams: make(map[uint32]*Stream), limit: make(chan bool, consts.PEER_STREAMS),
+		done: make(chan bool), Peer: peer}
+}
+
+func (m *MuxConn) writeFrame(id uint32, kind byte, data []byte) error {
+	frame := make([]byte, FRAME_HEADER, FRAME_HEADER+len(data))
+	binary.BigEndian.PutUint32(frame, id)
+	frame[4] = kind
+	binary.BigEndian.PutUint32(frame[5:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	m.wmutex.Lock()
+	defer m.wmutex.Unlock()
+	m.conn.SetWriteDeadline(time.Now().Add(consts.WRITE_TIMEOUT * time.Second))
+	_, err := m.conn.Write(frame)
+	if err != nil {
+		m.Close()
+	}
+	return err
+}
+
+// Closed returns true if the connection has been closed
+func (m *MuxConn) Closed() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the connection and all its streams
+func (m *MuxConn) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		m.conn.Close()
+	})
+}
+
+func (m *MuxConn) newStream(id uint32, limit int) *Stream {
+	stream := &Stream{id: id, mux: m, limit: limit, notify: make(chan bool, 1)}
+	m.mutex.Lock()
+	m.streams[id] = stream
+	m.mutex.Unlock()
+	return stream
+}
+
+func (m *MuxConn) stream(id uint32) *Stream {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.streams[id]
+}
+
+// Open starts the new request. It waits if there are PEER_STREAMS requests in the connection.
+func (m *MuxConn) Open(dataType int64) (*Stream, error) {
+	select {
+	case m.limit <- true:
+	case <-m.done:
+		return nil, fmt.Errorf(`connection is closed`)
+	case <-time.After(consts.WRITE_TIMEOUT * time.Second):
+		return nil, fmt.Errorf(`too many requests`)
+	}
+	m.mutex.Lock()
+	m.nextId++
+	id := m.nextId
+	m.mutex.Unlock()
+	limit := REQUEST_BUFFER
+	if dataType == consts.DATA_TYPE_BLOCKS || dataType == consts.DATA_TYPE_BLOCK_BODY {
+		limit = STREAM_BUFFER
+	}
+	stream := m.newStream(id, limit)
+	if err := m.writeFrame(id, frameOpen, DecToBin(dataType, 2)); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// KeepAlive sends ping every PEER_PING seconds until the connection is closed
+func (m *MuxConn) KeepAlive() {
+	ticker := time.NewTicker(consts.PEER_PING * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.writeFrame(0, framePing, nil)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Serve reads the frames until the connection is closed. accept is called in the separate goroutine for
+// every new request from the other node, the stream is closed after accept. The request is refused
+// if there are PEER_STREAMS requests in the connection.
+func (m *MuxConn) Serve(accept func(stream *Stream, dataType int64)) error {
+	defer m.Close()
+	header := make([]byte, FRAME_HEADER)
+	for {
+		m.conn.SetReadDeadline(time.Now().Add(consts.PEER_IDLE * time.Second))
+		if _, err := io.ReadFull(m.conn, header); err != nil {
+			return err
+		}
+		id := binary.BigEndian.Uint32(header)
+		size := binary.BigEndian.Uint32(header[5:])
+		if size > FRAME_CHUNK {
+			return fmt.Errorf(`frame is too big %d`, size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(m.conn, data); err != nil {
+			return err
+		}
+		switch header[4] {
+		case framePing:
+			m.writeFrame(0, framePong, nil)
+		case frameOpen:
+			if accept == nil {
+				m.writeFrame(id, frameClose, nil)
+				continue
+			}
+			select {
+			case m.limit <- true:
+			default:
+				m.writeFrame(id, frameClose, nil)
+				continue
+			}
+			stream := m.newStream(id, REQUEST_BUFFER)
+			go func() {
+				defer stream.Close()
+				accept(stream, BinToDec(data))
+			}()
+		case frameData:
+			if stream := m.stream(id); stream != nil {
+				stream.mutex.Lock()
+				overflow := len(stream.buf)+len(data) > stream.limit
+				if overflow {
+					stream.buf, stream.err = nil, fmt.Errorf(`stream buffer overflow`)
+				} else {
+					stream.buf = append(stream.buf, data...)
+				}
+				stream.mutex.Unlock()
+				stream.wake()
+				if overflow {
+					stream.reset()
+				}
+			}
+		case frameClose:
+			if stream := m.stream(id); stream != nil {
+				stream.mutex.Lock()
+				stream.eof = true
+				stream.mutex.Unlock()
+				stream.wake()
+			}
+		}
+	}
+}
+
+// reset removes the stream from the connection and tells the other node that the request is closed.
+// The owner of the stream still has to call Close.
+func (s *Stream) reset() {
+	s.mux.mutex.Lock()
+	delete(s.mux.streams, s.id)
+	s.mux.mutex.Unlock()
+	s.mux.writeFrame(s.id, frameClose, nil)
+}
+
+func (s *Stream) wake() {
+	select {
+	case s.notify <- true:
+	default:
+	}
+}
+
+// Read reads the data which have been sent by the other node. It returns io.EOF if the other node has
+// closed the request.
+func (s *Stream) Read(b []byte) (int, error) {
+	for {
+		s.mutex.Lock()
+		if s.err != nil {
+			s.mutex.Unlock()
+			return 0, s.err
+		}
+		if len(s.buf) > 0 {
+			n := copy(b, s.buf)
+			s.buf = s.buf[n:]
+			s.mutex.Unlock()
+			return n, nil
+		}
+		eof, deadline := s.eof, s.deadline
+		s.mutex.Unlock()
+		if eof {
+			return 0, io.EOF
+		}
+		if s.mux.Closed() {
+			return 0, fmt.Errorf(`connection is closed`)
+		}
+		wait := consts.READ_TIMEOUT * time.Second
+		if !deadline.IsZero() {
+			wait = deadline.Sub(time.Now())
+		}
+		if wait <= 0 {
+			return 0, fmt.Errorf(`read timeout`)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.notify:
+		case <-s.mux.done:
+		case <-timer.C:
+			return 0, fmt.Errorf(`read timeout`)
+		}
+		timer.Stop()
+	}
+}
+
+// Write sends the data to the other node
+func (s *Stream) Write(b []byte) (int, error) {
+	for off := 0; off < len(b); off += FRAME_CHUNK {
+		end := off + FRAME_CHUNK
+		if end > len(b) {
+			end = len(b)
+		}
+		if err := s.mux.writeFrame(s.id, frameData, b[off:end]); err != nil {
+			return off, err
+		}
+	}
+	return len(b), nil
+}
+
+// Close finishes the request
+func (s *Stream) Close() error {
+	s.closeOnce.Do(func() {
+		s.mux.mutex.Lock()
+		delete(s.mux.streams, s.id)
+		s.mux.mutex.Unlock()
+		if !s.mux.Closed() {
+			s.mux.writeFrame(s.id, frameClose, nil)
+		}
+		<-s.mux.limit
+	})
+	return nil
+}
+
+func (s *Stream) LocalAddr() net.Addr {
+	return s.mux.conn.LocalAddr()
+}
+
+func (s *Stream) RemoteAddr() net.Addr {
+	return s.mux.conn.RemoteAddr()
+}
+
+func (s *Stream) SetDeadline(t time.Time) error {
+	return s.SetReadDeadline(t)
+}
+
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.deadline = t
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
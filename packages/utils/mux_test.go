@@ -0,0 +1,60 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+)
+
+func TestMuxBuffer(t *testing.T) {
+	server, client := net.Pipe()
+	srv, cli := NewMuxConn(server, nil), NewMuxConn(client, nil)
+	defer srv.Close()
+	defer cli.Close()
+
+	accepted := make(chan *Stream)
+	done := make(chan bool)
+	go srv.Serve(func(stream *Stream, dataType int64) {
+		accepted <- stream
+		<-done
+	})
+	go cli.Serve(nil)
+
+	blocks, err := cli.Open(consts.DATA_TYPE_BLOCKS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocks.Close()
+	if blocks.limit != STREAM_BUFFER {
+		t.Errorf(`wrong limit of the blocks stream %d`, blocks.limit)
+	}
+	request := <-accepted
+	if request.limit != REQUEST_BUFFER {
+		t.Errorf(`wrong limit of the accepted stream %d`, request.limit)
+	}
+	// the accepted request doesn't read the data, so the other node can't fill more than REQUEST_BUFFER
+	if _, err = blocks.Write(make([]byte, REQUEST_BUFFER+4*FRAME_CHUNK)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = request.Read(make([]byte, 1)); err == nil || err.Error() != `stream buffer overflow` {
+		t.Errorf(`the overflow of the accepted stream has not been detected %v`, err)
+	}
+	close(done)
+}
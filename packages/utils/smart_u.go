@@ -18,10 +18,12 @@ package utils
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	//	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -151,6 +153,21 @@ func init() {
 		`Money`: Money, `Source`: Source, `Val`: Val, `Lang`: LangRes, `LangJS`: LangJS, `InputDate`: InputDate,
 		`MenuGroup`: MenuGroup, `MenuEnd`: MenuEnd, `MenuItem`: MenuItem, `MenuPage`: MenuPage, `MenuBack`: MenuBack, `WhiteMobileBg`: WhiteMobileBg, `Bin2Hex`: Bin2Hex, `MessageBoard`: MessageBoard,
 	})
+	textproc.AddInfo(&map[string]textproc.FuncInfo{`Back`: {Min: 2, Max: 3}, `BtnContract`: {Min: 3},
+		`BtnEdit`: {Min: 2}, `BtnPage`: {Min: 2}, `CmpTime`: {Min: 2, Raw: true}, `GetList`: {Min: 3, Raw: true},
+		`GetOne`: {Min: 2, Max: 4, Raw: true}, `GetRow`: {Min: 3, Raw: true}, `LinkPage`: {Min: 2},
+		`ListVal`: {Min: 3, Max: 3, Raw: true, Text: true}, `Mult`: {Min: 2, Max: 2, Raw: true},
+		`StateLink`: {Min: 2, Raw: true, Text: true}, `ValueById`: {Min: 3, Max: 4, Raw: true}, `WiAccount`: {Min: 1, Max: 1},
+		`WiBalance`: {Min: 2, Max: 2}, `Param`: {Min: 1, Raw: true, Text: true}, `StateVal`: {Min: 1, Raw: true, Text: true},
+		`Source`: {Min: 1, Raw: true}, `Money`: {Raw: true, Text: true}, `Date`: {Raw: true, Text: true},
+		`DateTime`: {Raw: true, Text: true}, `Trim`: {Raw: true, Text: true}, `Bin2Hex`: {Raw: true, Text: true},
+		`WiCitizen`: {Min: 2}, `If`: {Min: 1, Max: 3, End: `IfEnd`, Inline: 1}, `Else`: {Parent: `If`},
+		`ElseIf`: {Parent: `If`}, `ForList`: {Min: 1, Max: 1, End: `ForListEnd`}, `Divs`: {End: `DivsEnd`},
+		`UList`: {End: `UListEnd`}, `Form`: {End: `FormEnd`}, `MenuGroup`: {End: `MenuEnd`}, `LiBegin`: {End: `LiEnd`},
+		`Table`: {Keys: []string{`Table`, `Columns`}, Raw: true}, `TxForm`: {Keys: []string{`Contract`}},
+		`TxButton`: {Keys: []string{`Contract`}}, `ChartPie`: {Raw: true}, `ChartBar`: {Raw: true},
+	})
+	textproc.SetLoader(IncludePage)
 }
 
 // Reading and compiling contracts from smart_contracts tables
@@ -182,7 +199,7 @@ func LoadContract(prefix string) (err error) {
 		return err
 	}
 	for _, item := range contracts {
-		if err = smart.Compile(item[`value`], prefix, item[`active`] == `1`, StrToInt64(item[`id`])); err != nil {
+		if err = loadContractBlock(prefix, item); err != nil {
 			log.Error("Load Contract", item[`name`], err)
 			fmt.Println("Error Load Contract", item[`name`], err)
 			//return
@@ -193,6 +210,66 @@ func LoadContract(prefix string) (err error) {
 	return
 }
 
+// ReloadContract reads the contract from the table again and replaces it in VM. It is used after rollbacks.
+func ReloadContract(prefix string, id int64) error {
+	item, err := DB.OneRow(`select * from "`+prefix+`_smart_contracts" where id=?`, id).String()
+	if err != nil || len(item) == 0 {
+		return err
+	}
+	return loadContractBlock(prefix, item)
+}
+
+// loadContractBlock takes the compiled contract from smart_contracts_cache or compiles its source
+// and adds it to VM
+func loadContractBlock(prefix string, item map[string]string) error {
+	var root *script.Block
+	id := StrToInt64(item[`id`])
+	active := item[`active`] == `1`
+	code, err := DB.Single(`select code from smart_contracts_cache where prefix=? and id=? and hash=? and version=?`,
+		prefix, id, string(Sha256(item[`value`])), script.CODE_VERSION).Bytes()
+	if err != nil {
+		log.Error("Contract Cache", item[`name`], err)
+	} else if len(code) > 0 {
+		if root, err = smart.DecodeBlock(code); err != nil {
+			log.Error("Contract Cache", item[`name`], err)
+		}
+	}
+	if root == nil {
+		if root, err = smart.CompileBlock(item[`value`], prefix, active, id); err != nil {
+			return err
+		}
+		CacheContract(prefix, id, item[`value`], root)
+	}
+	for _, child := range root.Children {
+		if child.Type == script.OBJ_CONTRACT {
+			child.Info.(*script.ContractInfo).TblId = id
+			child.Info.(*script.ContractInfo).Active = active
+		}
+	}
+	smart.FlushBlock(root)
+	return nil
+}
+
+// CacheContract replaces the compiled contract in smart_contracts_cache. It must be called before FlushBlock.
+// The cache is local for the node so the errors are only logged.
+func CacheContract(prefix string, id int64, src string, root *script.Block) {
+	code, err := smart.EncodeBlock(root)
+	if err == nil {
+		if err = InvalidateContract(prefix, id); err == nil {
+			err = DB.ExecSql(`insert into smart_contracts_cache (prefix, id, hash, version, code) values(?,?,?,?,[hex])`,
+				prefix, id, string(Sha256(src)), script.CODE_VERSION, BinToHex(code))
+		}
+	}
+	if err != nil {
+		log.Error("Contract Cache", prefix, id, err)
+	}
+}
+
+// InvalidateContract deletes the compiled contract from smart_contracts_cache
+func InvalidateContract(prefix string, id int64) error {
+	return DB.ExecSql(`delete from smart_contracts_cache where prefix=? and id=?`, prefix, id)
+}
+
 func Balance(wallet_id int64) (decimal.Decimal, error) {
 	balance, err := DB.Single("SELECT amount FROM dlt_wallets WHERE wallet_id = ?", wallet_id).String()
 	if err != nil {
@@ -589,13 +666,13 @@ func MessageBoard(vars *map[string]string, pars ...string) string {
 		ret += `<a href="#" class="list-group-item">
 						<div class="media-box">
 							<div class="pull-left">
-								<img src="` + item[`ava`] + `" alt="Image" class="media-box-object img-circle thumb32">
+								<img src="` + template.HTMLEscapeString(item[`ava`]) + `" alt="Image" class="media-box-object img-circle thumb32">
 							</div>
 							<div class="media-box-body clearfix">
-								<small class="flag ru pull-right">` + item[`flag`] + `</small>
-								<strong class="media-box-heading text-primary">` + item[`username`] + `</strong>
+								<small class="flag ru pull-right">` + template.HTMLEscapeString(item[`flag`]) + `</small>
+								<strong class="media-box-heading text-primary">` + template.HTMLEscapeString(item[`username`]) + `</strong>
 								<p class="mb-sm pr-lg">
-									<small>` + item[`text`] + `</small>
+									<small>` + template.HTMLEscapeString(item[`text`]) + `</small>
 								</p>
 							</div>
 						</div>
@@ -633,8 +710,87 @@ func MessageBoard(vars *map[string]string, pars ...string) string {
 		</div>`, ret)
 }
 
+var (
+	reTablePrefix = regexp.MustCompile(`^(global|\d+)_`)
+	reSubquery    = regexp.MustCompile(`(?i)\bselect\b`)
+)
+
+// tableColumns returns the columns of the table which can be read by the page templates. These are id and
+// the columns from the permissions of the table in <prefix>_tables. The tables which are not described
+// there can't be read.
+func tableColumns(table string) (map[string]bool, error) {
+	table = strings.Trim(lib.EscapeName(table), `"`)
+	prefix := reTablePrefix.FindStringSubmatch(table)
+	if prefix == nil {
+		return nil, fmt.Errorf(`table %s is not allowed`, table)
+	}
+	data, err := DB.Single(`SELECT coalesce(columns_and_permissions->'update', '{}') FROM "`+prefix[1]+
+		`_tables" WHERE name = ?`, table).String()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf(`table %s is not allowed`, table)
+	}
+	perm := make(map[string]string)
+	if err = json.Unmarshal([]byte(data), &perm); err != nil {
+		return nil, err
+	}
+	columns := map[string]bool{`id`: true}
+	for key := range perm {
+		columns[strings.ToLower(key)] = true
+	}
+	return columns, nil
+}
+
+// checkColumns returns an error if the list contains the columns which are not allowed. The directions
+// of the sorting are allowed if order is true.
+func checkColumns(columns map[string]bool, list string, order bool) error {
+	for _, item := range strings.Split(list, `,`) {
+		for i, name := range strings.Fields(strings.ToLower(item)) {
+			if i > 0 && order {
+				switch name {
+				case `asc`, `desc`, `nulls`, `first`, `last`:
+					continue
+				}
+			}
+			if i > 0 || !columns[strings.Trim(name, `"`)] {
+				return fmt.Errorf(`column %s is not allowed`, strings.TrimSpace(item))
+			}
+		}
+	}
+	return nil
+}
+
+// allColumns returns the list of the allowed columns instead of *
+func allColumns(columns map[string]bool) string {
+	list := make([]string, 0, len(columns))
+	for key := range columns {
+		list = append(list, lib.EscapeName(key))
+	}
+	sort.Strings(list)
+	return strings.Join(list, `,`)
+}
+
+// checkWhere returns an error if the condition has a subquery, so the condition can use only the table itself
+func checkWhere(where string) error {
+	if reSubquery.MatchString(where) {
+		return fmt.Errorf(`subquery is not allowed in %s`, where)
+	}
+	return nil
+}
+
+// queryArgs returns the values of $1, $2 ... placeholders of the query
+func queryArgs(pars []string) []interface{} {
+	args := make([]interface{}, len(pars))
+	for i, item := range pars {
+		args[i] = strings.TrimSpace(item)
+	}
+	return args
+}
+
 func GetList(vars *map[string]string, pars ...string) string {
-	// name, table, fields, where, order, limit
+	// name, table, fields, where, order, limit, params of where
 	if len(pars) < 3 {
 		return ``
 	}
@@ -643,17 +799,34 @@ func GetList(vars *map[string]string, pars ...string) string {
 	limit := -1
 	fields := lib.Escape(pars[2])
 	keys := strings.Split(fields, `,`)
+	columns, err := tableColumns(pars[1])
+	if err == nil {
+		err = checkColumns(columns, fields, false)
+	}
+	if err != nil {
+		return err.Error()
+	}
 	if len(pars) >= 4 {
+		if err = checkWhere(pars[3]); err != nil {
+			return err.Error()
+		}
 		where = ` where ` + lib.Escape(pars[3])
 	}
 	if len(pars) >= 5 {
+		if err = checkColumns(columns, pars[4], true); err != nil {
+			return err.Error()
+		}
 		order = ` order by ` + lib.EscapeName(pars[4])
 	}
 	if len(pars) >= 6 {
 		limit = StrToInt(pars[5])
 	}
+	var args []interface{}
+	if len(pars) > 6 {
+		args = queryArgs(pars[6:])
+	}
 
-	value, err := DB.GetAll(`select `+fields+` from `+lib.EscapeName(pars[1])+where+order, limit)
+	value, err := DB.GetAll(`select `+fields+` from `+lib.EscapeName(pars[1])+where+order, limit, args...)
 	if err != nil {
 		return err.Error()
 	}
@@ -669,10 +842,6 @@ func GetList(vars *map[string]string, pars ...string) string {
 			}
 		}
 		for key, ival := range item {
-			if strings.IndexByte(ival, '<') >= 0 {
-				//				item[key] = lib.StripTags(ival)
-				ival = lib.StripTags(ival)
-			}
 			if ival == `NULL` {
 				ival = ``
 			}
@@ -717,17 +886,32 @@ func ListVal(vars *map[string]string, pars ...string) string {
 }
 
 func GetRowVars(vars *map[string]string, pars ...string) string {
-	if len(pars) != 4 && len(pars) != 3 {
+	// prefix, table, column, value or prefix, table, where, params of where
+	if len(pars) < 3 {
 		return ``
 	}
-	where := ``
-	if len(pars) == 4 {
-		where = ` where ` + lib.EscapeName(pars[2]) + `='` + lib.Escape(pars[3]) + `'`
-	} else if len(pars) == 3 {
-		where = ` where ` + lib.Escape(pars[2])
+	var args []interface{}
+	columns, err := tableColumns(pars[1])
+	if err != nil {
+		return err.Error()
 	}
-	fmt.Println(`select * from ` + lib.EscapeName(pars[1]) + where)
-	value, err := DB.OneRow(`select * from ` + lib.EscapeName(pars[1]) + where).String()
+	fields := allColumns(columns)
+	where := ` where ` + lib.Escape(pars[2])
+	if strings.IndexByte(pars[2], '$') >= 0 || len(pars) == 3 {
+		if err = checkWhere(pars[2]); err != nil {
+			return err.Error()
+		}
+		args = queryArgs(pars[3:])
+	} else if len(pars) == 4 {
+		if err = checkColumns(columns, pars[2], false); err != nil {
+			return err.Error()
+		}
+		where = ` where ` + lib.EscapeName(pars[2]) + `=?`
+		args = queryArgs(pars[3:])
+	} else if len(pars) > 4 {
+		return ``
+	}
+	value, err := DB.OneRow(`select `+fields+` from `+lib.EscapeName(pars[1])+where, args...).String()
 	if err != nil {
 		return err.Error()
 	}
@@ -735,7 +919,7 @@ func GetRowVars(vars *map[string]string, pars ...string) string {
 		if val == `NULL` {
 			val = ``
 		}
-		(*vars)[pars[0]+`_`+key] = lib.StripTags(val)
+		(*vars)[pars[0]+`_`+key] = val
 	}
 	return ``
 }
@@ -757,7 +941,7 @@ func GetOne(vars *map[string]string, pars ...string) string {
 	if value == `NULL` {
 		value = ``
 	}
-	return strings.Replace(lib.StripTags(value), "\n", "\n<br>", -1)
+	return strings.Replace(template.HTMLEscapeString(value), "\n", "\n<br>", -1)
 }
 
 func getClass(class string) (string, string) {
@@ -995,14 +1179,15 @@ func SetVar(vars *map[string]string, pars ...string) string {
 			val = lr[1]
 			//		val = strings.Replace(val, `#!`, `#`, -1)
 		}
-		(*vars)[strings.TrimSpace(lr[0])] = strings.Trim(val, " `\"")
+		textproc.SetSafe(vars, strings.TrimSpace(lr[0]), strings.Trim(val, " `\""))
 	}
 	return ``
 }
 
 func TextHidden(vars *map[string]string, pars ...string) (out string) {
 	for _, item := range pars {
-		out += fmt.Sprintf(`<textarea style="display:none;" id="%s">%s</textarea>`, item, (*vars)[item])
+		out += fmt.Sprintf(`<textarea style="display:none;" id="%s">%s</textarea>`, item,
+			template.HTMLEscapeString((*vars)[item]))
 	}
 	return
 }
@@ -1126,7 +1311,95 @@ func StateLink(vars *map[string]string, pars ...string) string {
 	return (*vars)[fmt.Sprintf(`%s_%s`, pars[0], pars[1])]
 }
 
+var (
+	reTableName = regexp.MustCompile(`^\w+$`)
+	reTableSort = regexp.MustCompile(`^\s*#(\w+)#\s*$`)
+)
+
+// tableArgs returns the values of Param1, Param2 ... keys of Table which are $1, $2 ... of Where.
+// Each value is a separate key, so the substituted values can have commas.
+func tableArgs(pars *map[string]string) []interface{} {
+	args := make([]interface{}, 0)
+	for i := 1; ; i++ {
+		val, ok := (*pars)[fmt.Sprintf(`Param%d`, i)]
+		if !ok {
+			return args
+		}
+		args = append(args, strings.TrimSpace(val))
+	}
+}
+
+// tableSort returns the column and the direction of the sorting which have been sent by the client.
+// The column is empty if it can't be sorted.
+func tableSort(vars *map[string]string, name string, sortable, allowed map[string]bool) (string, bool) {
+	col := strings.ToLower(strings.TrimSpace((*vars)[name+`_sort`]))
+	if !sortable[col] || checkColumns(allowed, col, false) != nil {
+		return ``, false
+	}
+	return col, (*vars)[name+`_desc`] == `1`
+}
+
+// tableSearch adds the search of the text in the columns to the condition of the query
+func tableSearch(where, columns, search string, args []interface{}) (string, []interface{}) {
+	cond := make([]string, 0)
+	for _, col := range strings.Split(columns, `,`) {
+		cond = append(cond, fmt.Sprintf(`%s::text ilike $%d`, lib.EscapeName(strings.TrimSpace(col)), len(args)+1))
+	}
+	args = append(args, `%`+search+`%`)
+	if len(where) > 0 {
+		return `where (` + where[6:] + `) and (` + strings.Join(cond, ` or `) + `)`, args
+	}
+	return `where ` + strings.Join(cond, ` or `), args
+}
+
+// tablePage returns the current page in the range from 1 to the count of the pages and the count of the pages
+func tablePage(page, count, size int64) (int64, int64) {
+	pages := (count + size - 1) / size
+	if page > pages {
+		page = pages
+	}
+	if page < 1 {
+		page = 1
+	}
+	return page, pages
+}
+
+// tablePages returns the navigation between the pages of the table
+func tablePages(name string, page, pages int64) string {
+	if pages < 2 {
+		return ``
+	}
+	link := func(num int64, title, class string) string {
+		return fmt.Sprintf(`<li class="%s"><a href="#" onclick="load_table('%s', {'%[2]s_page': %d}); return false;">%s</a></li>`,
+			class, name, num, title)
+	}
+	out := `<ul class="pagination">`
+	if page > 1 {
+		out += link(page-1, `&laquo;`, ``)
+	}
+	for i := int64(1); i <= pages; i++ {
+		if i == 1 || i == pages || (i >= page-2 && i <= page+2) {
+			class := ``
+			if i == page {
+				class = `active`
+			}
+			out += link(i, Int64ToStr(i), class)
+		} else if i == page-3 || i == page+3 {
+			out += `<li class="disabled"><span>...</span></li>`
+		}
+	}
+	if page < pages {
+		out += link(page+1, `&raquo;`, ``)
+	}
+	return out + `</ul>`
+}
+
 func Table(vars *map[string]string, pars *map[string]string) string {
+	var (
+		name, search, sortCol string
+		page, pages, size     int64
+		desc                  bool
+	)
 	fields := `*`
 	order := ``
 	where := ``
@@ -1134,7 +1407,14 @@ func Table(vars *map[string]string, pars *map[string]string) string {
 	tableClass := ``
 	tableMore := ``
 	adaptive := ``
+	allowed, err := tableColumns((*pars)[`Table`])
+	if err != nil {
+		return err.Error()
+	}
 	if val, ok := (*pars)[`Order`]; ok {
+		if err = checkColumns(allowed, lib.Escape(val), true); err != nil {
+			return err.Error()
+		}
 		order = `order by ` + lib.Escape(val)
 	}
 	if val, ok := (*pars)[`Class`]; ok {
@@ -1144,6 +1424,9 @@ func Table(vars *map[string]string, pars *map[string]string) string {
 		adaptive = `data-role="table"`
 	}
 	if val, ok := (*pars)[`Where`]; ok {
+		if err = checkWhere(val); err != nil {
+			return err.Error()
+		}
 		where = `where ` + lib.Escape(val)
 	}
 	if val, ok := (*pars)[`Limit`]; ok && len(val) > 0 {
@@ -1157,14 +1440,64 @@ func Table(vars *map[string]string, pars *map[string]string) string {
 	if val, ok := (*pars)[`Fields`]; ok {
 		fields = lib.Escape(val)
 	}
+	if fields == `*` {
+		fields = allColumns(allowed)
+	} else if err = checkColumns(allowed, fields, false); err != nil {
+		return err.Error()
+	}
+	args := tableArgs(pars)
+	columns := textproc.Split((*pars)[`Columns`])
+	// the columns which are output as is can be sorted by the user
+	sortable := make(map[string]bool)
+	for _, th := range *columns {
+		if len(th) > 1 {
+			if ret := reTableSort.FindStringSubmatch(th[1]); ret != nil {
+				sortable[strings.ToLower(ret[1])] = true
+			}
+		}
+	}
+	if size = StrToInt64((*pars)[`PageSize`]); size > 0 {
+		// the page, the sorting and the search are sent by the client in <name>_page, <name>_sort,
+		// <name>_desc and <name>_search parameters
+		name = `table`
+		if val := strings.TrimSpace((*pars)[`Name`]); reTableName.MatchString(val) {
+			name = val
+		}
+		search = strings.TrimSpace((*vars)[name+`_search`])
+		if sortCol, desc = tableSort(vars, name, sortable, allowed); len(sortCol) > 0 {
+			order = `order by ` + lib.EscapeName(sortCol)
+			if desc {
+				order += ` desc`
+			}
+		}
+		if val := lib.Escape((*pars)[`Search`]); len(search) > 0 && len(val) > 0 {
+			if err = checkColumns(allowed, val, false); err != nil {
+				return err.Error()
+			}
+			where, args = tableSearch(where, val, search, args)
+		}
+		count, err := DB.Single(fmt.Sprintf(`select count(*) from %s %s`, lib.EscapeName((*pars)[`Table`]), where),
+			args...).Int64()
+		if err != nil {
+			return err.Error()
+		}
+		page, pages = tablePage(StrToInt64((*vars)[name+`_page`]), count, size)
+		limit = fmt.Sprintf(` offset %d limit %d`, (page-1)*size, size)
+	}
 	list, err := DB.GetAll(fmt.Sprintf(`select %s from %s %s %s%s`, fields,
-		lib.EscapeName((*pars)[`Table`]), where, order, limit), -1)
+		lib.EscapeName((*pars)[`Table`]), where, order, limit), -1, args...)
 	if err != nil {
 		return err.Error()
 	}
-	columns := textproc.Split((*pars)[`Columns`])
 
 	out := ``
+	if size > 0 {
+		out += fmt.Sprintf(`<div id="%s" class="witable">`, name)
+		if len((*pars)[`Search`]) > 0 {
+			out += fmt.Sprintf(`<input type="text" class="form-control" value="%s" onchange="load_table('%s', {'%[2]s_search': this.value, '%[2]s_page': 1})">`,
+				template.HTMLEscapeString(search), name)
+		}
+	}
 	if strings.TrimSpace(tableClass) == `table-responsive` {
 		out += `<div class="table-responsive">`
 	}
@@ -1181,7 +1514,22 @@ func Table(vars *map[string]string, pars *map[string]string) string {
 				class = fmt.Sprintf(`class="%s"`, class)
 			}
 		}
-		out += fmt.Sprintf(`<th %s %s>`, class, more) + th[0] + `</th>`
+		title := th[0]
+		if ret := reTableSort.FindStringSubmatch(th[1]); ret != nil && size > 0 {
+			col := strings.ToLower(ret[1])
+			var isdesc int
+			if col == sortCol {
+				if desc {
+					title += ` <em class="fa fa-sort-amount-desc"></em>`
+				} else {
+					title += ` <em class="fa fa-sort-amount-asc"></em>`
+					isdesc = 1
+				}
+			}
+			title = fmt.Sprintf(`<a href="#" onclick="load_table('%[1]s', {'%[1]s_sort': '%[2]s', '%[1]s_desc': %[3]d, '%[1]s_page': 1}); return false;">%[4]s</a>`,
+				name, col, isdesc, title)
+		}
+		out += fmt.Sprintf(`<th %s %s>`, class, more) + title + `</th>`
 		th[1] = strings.TrimSpace(th[1])
 		off := strings.Index(th[1], `StateLink`)
 
@@ -1205,7 +1553,7 @@ func Table(vars *map[string]string, pars *map[string]string) string {
 				value = ``
 			}
 			if key != `state_id` {
-				(*vars)[key] = lib.StripTags(value)
+				(*vars)[key] = value
 			}
 		}
 		for _, th := range *columns {
@@ -1225,6 +1573,9 @@ func Table(vars *map[string]string, pars *map[string]string) string {
 	if strings.TrimSpace(tableClass) == `table-responsive` {
 		out += `</div>`
 	}
+	if size > 0 {
+		out += tablePages(name, page, pages) + `</div>`
+	}
 	return out
 }
 
@@ -1369,6 +1720,9 @@ func Legend(vars *map[string]string, pars ...string) (out string) {
 
 func GetVar(vars *map[string]string, pars ...string) (out string) {
 	if val, ok := (*vars)[pars[0]]; ok {
+		if !textproc.IsSafe(vars, pars[0]) {
+			return template.HTMLEscapeString(val)
+		}
 		out = textproc.Process(val, vars)
 		if out == `NULL` {
 			out = textproc.Macro(val, vars)
@@ -1917,7 +2271,7 @@ func Select(vars *map[string]string, pars ...string) string {
 				return err.Error()
 			} else if len(data) > 0 {
 				for _, item := range data {
-					list = append(list, SelInfo{Id: StrToInt64(item[id]), Name: lib.StripTags(item[name])})
+					list = append(list, SelInfo{Id: StrToInt64(item[id]), Name: template.HTMLEscapeString(item[name])})
 				}
 			}
 		} else if alist := strings.Split(StateVal(vars, pars[1]), `,`); len(alist) > 0 {
@@ -2069,8 +2423,8 @@ func ChartBar(vars *map[string]string, pars *map[string]string) string {
 		if item[value] == `NULL` {
 			item[value] = ``
 		}
-		data = append(data, lib.StripTags(item[value]))
-		labels = append(labels, `'`+lib.StripTags(item[label])+`'`)
+		data = append(data, fmt.Sprint(StrToFloat64(item[value])))
+		labels = append(labels, `'`+template.JSEscapeString(item[label])+`'`)
 	}
 	//	}
 	return fmt.Sprintf(`<div><canvas id="%s"></canvas>
@@ -2167,7 +2521,7 @@ func ChartPie(vars *map[string]string, pars *map[string]string) string {
 				color: '#%s',
 				highlight: '#%s',
 				label: '%s'
-			}`, lib.StripTags(item[value]), color, color, lib.StripTags(item[label])))
+			}`, fmt.Sprint(StrToFloat64(item[value])), color, color, template.JSEscapeString(item[label])))
 		}
 	}
 	return fmt.Sprintf(`<div><canvas id="%s"></canvas>
@@ -921,7 +921,20 @@ func (db *DCDB) GetMyCBIDAndWalletId() (int64, int64, error) {
 	return myCBID, myWalletId, nil
 }
 
+// GetHosts returns the full nodes and the peers which have completed the handshake. The banned hosts are skipped.
 func (db *DCDB) GetHosts() ([]string, error) {
+	hosts, err := db.GetList(fmt.Sprintf(`SELECT host FROM full_nodes WHERE host NOT IN
+		(SELECT host FROM peers WHERE ban_score >= ?) UNION
+		(SELECT host FROM peers WHERE last_seen > 0 AND ban_score < ? ORDER BY last_seen DESC, latency LIMIT %d)`,
+		consts.PEERS_COUNT), consts.MAX_BAN_SCORE, consts.MAX_BAN_SCORE).String()
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// GetFullNodesHosts returns the hosts of the full nodes only
+func (db *DCDB) GetFullNodesHosts() ([]string, error) {
 	q := ""
 	if db.ConfigIni["db_type"] == "postgresql" {
 		q = "SELECT DISTINCT ON (host) host FROM full_nodes"
@@ -1289,11 +1302,6 @@ func (db *DCDB) GetAiId(table string) (string, error) {
 	return column, nil
 }
 
-func (db *DCDB) NodesBan(info string) error {
-
-	return nil
-}
-
 func (db *DCDB) GetBlockDataFromBlockChain(blockId int64) (*BlockData, error) {
 	BlockData := new(BlockData)
 	data, err := db.OneRow("SELECT * FROM block_chain WHERE id = ?", blockId).String()
@@ -0,0 +1,91 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTableQuery(t *testing.T) {
+	columns := map[string]bool{`id`: true, `name`: true, `amount`: true}
+	for list, ok := range map[string]bool{`id,name`: true, `name, "amount"`: true, `id,key`: false,
+		`name amount`: false, `amount desc`: false} {
+		if err := checkColumns(columns, list, false); (err == nil) != ok {
+			t.Errorf(`wrong check of columns %s: %v`, list, err)
+		}
+	}
+	if err := checkColumns(columns, `amount desc nulls last, id`, true); err != nil {
+		t.Error(err)
+	}
+	if err := checkColumns(nil, `id`, false); err == nil {
+		t.Errorf(`the columns of the unknown table are allowed`)
+	}
+	if cols := allColumns(columns); cols != `"amount","id","name"` {
+		t.Errorf(`wrong columns %s`, cols)
+	}
+	for where, ok := range map[string]bool{`citizen_id = $1`: true, `name = 'selection'`: true,
+		`id in (select id from dlt_wallets)`: false, `id = (SELECT 1)`: false} {
+		if err := checkWhere(where); (err == nil) != ok {
+			t.Errorf(`wrong check of where %s: %v`, where, err)
+		}
+	}
+	args := tableArgs(&map[string]string{`Param1`: ` Smith, John `, `Param2`: `10`, `Param4`: `skipped`})
+	if fmt.Sprint(args) != `[Smith, John 10]` || len(args) != 2 {
+		t.Errorf(`wrong params %v`, args)
+	}
+}
+
+func TestTablePaging(t *testing.T) {
+	vars := map[string]string{`list_sort`: ` Name `, `list_desc`: `1`}
+	sortable := map[string]bool{`name`: true, `key`: true}
+	allowed := map[string]bool{`id`: true, `name`: true}
+	if col, desc := tableSort(&vars, `list`, sortable, allowed); col != `name` || !desc {
+		t.Errorf(`wrong sort %s %v`, col, desc)
+	}
+	vars[`list_sort`] = `key`
+	if col, _ := tableSort(&vars, `list`, sortable, allowed); col != `` {
+		t.Errorf(`the column which is not allowed is sorted %s`, col)
+	}
+	vars[`list_sort`] = `id`
+	if col, _ := tableSort(&vars, `list`, sortable, allowed); col != `` {
+		t.Errorf(`the column which is not in Columns is sorted %s`, col)
+	}
+
+	where, args := tableSearch(`where id > $1`, `name, amount`, `bob`, []interface{}{`5`})
+	if where != `where (id > $1) and ("name"::text ilike $2 or "amount"::text ilike $2)` {
+		t.Errorf(`wrong search %s`, where)
+	}
+	if fmt.Sprint(args) != `[5 %bob%]` {
+		t.Errorf(`wrong search params %v`, args)
+	}
+	if where, _ = tableSearch(``, `name`, `bob`, nil); where != `where "name"::text ilike $1` {
+		t.Errorf(`wrong search %s`, where)
+	}
+
+	for _, item := range []struct {
+		page, count, size int64
+		want              string
+	}{{0, 95, 10, `1 10`}, {4, 95, 10, `4 10`}, {12, 95, 10, `10 10`}, {3, 0, 10, `1 0`}, {-1, 10, 10, `1 1`}} {
+		if page, pages := tablePage(item.page, item.count, item.size); fmt.Sprint(page, ` `, pages) != item.want {
+			t.Errorf(`wrong page %d %d of %v`, page, pages, item)
+		}
+	}
+	if out := tablePages(`list`, 1, 1); out != `` {
+		t.Errorf(`the navigation of one page %s`, out)
+	}
+}
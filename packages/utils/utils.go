@@ -117,6 +117,11 @@ var (
 	BoltDir                 = flag.String("boltDir", GetCurrentDir(), "Bolt directory")
 	BoltPsw                 = flag.String("boltPsw", "", "Bolt password")
 	ApiToken                = flag.String("apiToken", "", "Api Token")
+	ApiRate                 = flag.Int64("apiRate", 60, "The maximum count of exchangeapi requests per minute for a token")
+	ApiHost                 = flag.String("apiHost", "", "Separate host:port for exchangeapi (e.g. 127.0.0.1:7080)")
+	WebhookUrl              = flag.String("webhookUrl", "", "URL for the notifications about incoming transfers to exchangeapi wallets")
+	WebhookSecret           = flag.String("webhookSecret", "", "The key of HMAC-SHA256 signature of the webhook notifications")
+	WebhookConfirm          = flag.Int64("webhookConfirm", 6, "The count of the confirmations before the webhook notification")
 	OneCountry              int64
 	PrivCountry             bool
 	OutFile                 *os.File
@@ -2129,18 +2134,13 @@ func GetCurrentDir() string {
 
 func GetBlockBody(host string, blockId int64, dataTypeBlockBody int64) ([]byte, error) {
 
-	conn, err := TcpConn(host)
-	if err != nil {
-		return nil, ErrInfo(err)
-	}
-	defer conn.Close()
-
 	log.Debug("dataTypeBlockBody: %v", dataTypeBlockBody)
 	// шлем тип данных
-	_, err = conn.Write(DecToBin(dataTypeBlockBody, 2))
+	conn, err := TcpRequest(host, dataTypeBlockBody)
 	if err != nil {
 		return nil, ErrInfo(err)
 	}
+	defer conn.Close()
 
 	log.Debug("blockId: %v", blockId)
 
@@ -2351,13 +2351,66 @@ func FillLeft(slice []byte) []byte {
 	return lib.FillLeft(slice)
 }
 
+// pageCache contains the parsed templates of the pages. The key is table + name of the page.
+// version is increased by every change of the pages so the template which has been read
+// before the change is not cached.
+var pageCache = struct {
+	sync.RWMutex
+	version uint64
+	list    map[string]*textproc.Program
+}{list: make(map[string]*textproc.Program)}
+
+// GetPageTemplate returns the parsed template of the page from the cache or reads it from the table.
+// It returns nil if the page is not found.
+func GetPageTemplate(table, name string) (*textproc.Program, error) {
+	key := table + `.` + name
+	pageCache.RLock()
+	prog, ok := pageCache.list[key]
+	version := pageCache.version
+	pageCache.RUnlock()
+	if ok {
+		return prog, nil
+	}
+	data, err := DB.Single(`SELECT value FROM "`+table+`" WHERE name = ?`, name).String()
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	prog = textproc.Parse(data)
+	pageCache.Lock()
+	if pageCache.version == version {
+		pageCache.list[key] = prog
+	}
+	pageCache.Unlock()
+	return prog, nil
+}
+
+// InvalidatePage removes the template of the page from the cache. It must be called when the page has been changed.
+func InvalidatePage(table, name string) {
+	pageCache.Lock()
+	pageCache.version++
+	delete(pageCache.list, table+`.`+name)
+	pageCache.Unlock()
+}
+
+// IncludePage returns the page for Include function. The page is looked for in the pages of the state
+// and then in global_pages.
+func IncludePage(vars *map[string]string, name string) (*textproc.Program, error) {
+	if (*vars)[`global`] != `1` {
+		prog, err := GetPageTemplate(Int64ToStr(StrToInt64((*vars)[`state_id`]))+`_pages`, name)
+		if err != nil || prog != nil {
+			return prog, err
+		}
+	}
+	return GetPageTemplate(`global_pages`, name)
+}
+
 func CreateHtmlFromTemplate(page string, citizenId, stateId int64, params *map[string]string) (string, error) {
-	query := `SELECT value FROM "` + Int64ToStr(stateId) + `_pages" WHERE name = ?`
+	table := Int64ToStr(stateId) + `_pages`
 	if (*params)[`global`] == `1` {
-		query = `SELECT value FROM global_pages WHERE name = ?`
+		table = `global_pages`
 	}
 
-	data, err := DB.Single(query, page).String()
+	prog, err := GetPageTemplate(table, page)
 	if err != nil {
 		return "", err
 	}
@@ -2368,8 +2421,8 @@ func CreateHtmlFromTemplate(page string, citizenId, stateId int64, params *map[s
 	(*params)[`page`] = page
 	(*params)[`state_id`] = Int64ToStr(stateId)
 	(*params)[`citizen`] = Int64ToStr(citizenId)
-	if len(data) > 0 {
-		templ := textproc.Process(data, params)
+	if prog != nil {
+		templ := prog.Process(params)
 		if (*params)[`isrow`] == `opened` {
 			templ += `</div>`
 			(*params)[`isrow`] = ``
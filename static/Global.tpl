@@ -584,7 +584,6 @@ Divs(md-6, panel panel-info elastic center)
             If(#Back#==1,BtnPage(government, <strong>$ListVotings$</strong> ,"Status:1",btn btn-oval btn-info f0,'list'), BtnPage(glrf_List, <strong>$ListVotings$</strong>, "Status:0,global:1",btn btn-oval btn-info f0,'list'))
         DivsEnd:
     DivsEnd:
-DivsEnd:
 
 Divs(md-6, panel panel-default elastic center)
     Divs: panel-body canvas-responsive
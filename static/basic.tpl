@@ -1749,7 +1749,6 @@ Divs(md-6, panel panel-info elastic center)
             If(#Back#==1,BtnPage(RF_UserList, <strong>$ListVotings$</strong> ,"Status:1",btn btn-oval btn-info f0), BtnPage(RF_List, <strong>$ListVotings$</strong>, "Status:0",btn btn-oval btn-info f0))
         DivsEnd:
     DivsEnd:
-DivsEnd:
 
 Divs(md-6, panel elastic center panel-default)
     Divs: panel-body canvas-responsive
@@ -565,6 +565,23 @@ function load_template(page, parameters, anchor, customFunc) {
 		}, "html");
 }
 
+function load_table(id, parameters) {
+	var cur = hist[hist_cur];
+	if (!cur || cur[0] != 'load_template') {
+		return;
+	}
+	var params = $.extend({}, cur[2], parameters);
+	$.post("template?page=" + cur[1], params,
+		function (data) {
+			var table = $('<div>').append($.parseHTML(data)).find('#' + id);
+			if (table.length) {
+				$('#' + id).replaceWith(table);
+				updateLanguage('#' + id + ' .lang');
+				cur[2] = params;
+			}
+		}, "html");
+}
+
 function load_app(page, parameters) {
 	clearAllTimeouts();
 	NProgress.set(1.0);
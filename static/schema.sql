@@ -10,12 +10,14 @@ DROP TABLE IF EXISTS "dlt_transactions"; CREATE TABLE "dlt_transactions" (
 "time" int  NOT NULL DEFAULT '0',
 "comment" text NOT NULL DEFAULT '',
 "block_id" int  NOT NULL DEFAULT '0',
+"tx_hash" bytea  NOT NULL DEFAULT '',
 "rb_id" int  NOT NULL DEFAULT '0'
 );
 ALTER SEQUENCE "dlt_transactions_id_seq" owned by "dlt_transactions".id;
 ALTER TABLE ONLY "dlt_transactions" ADD CONSTRAINT "dlt_transactions_pkey" PRIMARY KEY (id);
 CREATE INDEX dlt_transactions_index_sender ON "dlt_transactions" (sender_wallet_id);
 CREATE INDEX dlt_transactions_index_recipient ON "dlt_transactions" (recipient_wallet_id);
+CREATE INDEX dlt_transactions_index_block ON "dlt_transactions" (block_id);
 
 
 
@@ -84,6 +86,25 @@ DROP TABLE IF EXISTS "confirmations"; CREATE TABLE "confirmations" (
 );
 ALTER TABLE ONLY "confirmations" ADD CONSTRAINT confirmations_pkey PRIMARY KEY (block_id);
 
+DROP SEQUENCE IF EXISTS reorg_log_id_seq CASCADE;
+CREATE SEQUENCE reorg_log_id_seq START WITH 1;
+DROP TABLE IF EXISTS "reorg_log"; CREATE TABLE "reorg_log" (
+"id" bigint NOT NULL  default nextval('reorg_log_id_seq'),
+"time" int NOT NULL DEFAULT '0',
+"host" varchar(100) NOT NULL DEFAULT '',
+"fork_block_id" int NOT NULL DEFAULT '0',
+"depth" int NOT NULL DEFAULT '0',
+"old_block_id" int NOT NULL DEFAULT '0',
+"old_hash" bytea  NOT NULL DEFAULT '',
+"new_block_id" int NOT NULL DEFAULT '0',
+"new_hash" bytea  NOT NULL DEFAULT '',
+"status" varchar(20) NOT NULL DEFAULT '',
+"reason" text NOT NULL DEFAULT '',
+"error" text NOT NULL DEFAULT ''
+);
+ALTER SEQUENCE reorg_log_id_seq owned by reorg_log.id;
+ALTER TABLE ONLY "reorg_log" ADD CONSTRAINT reorg_log_pkey PRIMARY KEY (id);
+
 
 
 
@@ -167,6 +188,17 @@ DROP TABLE IF EXISTS "full_nodes"; CREATE TABLE "full_nodes" (
 ALTER SEQUENCE full_nodes_id_seq owned by full_nodes.id;
 ALTER TABLE ONLY "full_nodes" ADD CONSTRAINT full_nodes_pkey PRIMARY KEY (id);
 
+DROP TABLE IF EXISTS "peers"; CREATE TABLE "peers" (
+"host" varchar(100) NOT NULL DEFAULT '',
+"last_seen" int NOT NULL DEFAULT '0',
+"latency" int NOT NULL DEFAULT '0',
+"block_id" int NOT NULL DEFAULT '0',
+"ban_score" int NOT NULL DEFAULT '0',
+"ban_time" int NOT NULL DEFAULT '0',
+"source" varchar(100) NOT NULL DEFAULT ''
+);
+ALTER TABLE ONLY "peers" ADD CONSTRAINT peers_pkey PRIMARY KEY (host);
+
 
 
 
@@ -502,6 +534,32 @@ CREATE TABLE "global_tables" (
 );
 ALTER TABLE ONLY "global_tables" ADD CONSTRAINT global_tables_pkey PRIMARY KEY (name);
 
+DROP TABLE IF EXISTS "smart_contracts_cache"; CREATE TABLE "smart_contracts_cache" (
+"prefix" varchar(32) NOT NULL DEFAULT '',
+"id" bigint NOT NULL DEFAULT '0',
+"hash" varchar(64) NOT NULL DEFAULT '',
+"version" int NOT NULL DEFAULT '0',
+"code" bytea  NOT NULL DEFAULT ''
+);
+ALTER TABLE ONLY "smart_contracts_cache" ADD CONSTRAINT smart_contracts_cache_pkey PRIMARY KEY (prefix, id);
+
+DROP SEQUENCE IF EXISTS events_id_seq CASCADE;
+CREATE SEQUENCE events_id_seq START WITH 1;
+DROP TABLE IF EXISTS "events"; CREATE TABLE "events" (
+"id" bigint NOT NULL  default nextval('events_id_seq'),
+"block_id" bigint NOT NULL DEFAULT '0',
+"tx_hash" bytea  NOT NULL DEFAULT '',
+"state_id" bigint NOT NULL DEFAULT '0',
+"contract" varchar(100)  NOT NULL DEFAULT '',
+"name" varchar(100)  NOT NULL DEFAULT '',
+"data" jsonb,
+"rb_id" bigint NOT NULL DEFAULT '0'
+);
+ALTER SEQUENCE "events_id_seq" owned by "events".id;
+ALTER TABLE ONLY "events" ADD CONSTRAINT events_pkey PRIMARY KEY (id);
+CREATE INDEX events_index_block ON "events" (block_id);
+CREATE INDEX events_index_name ON "events" (state_id, contract, name);
+
 DROP SEQUENCE IF EXISTS system_states_id_seq CASCADE;
 CREATE SEQUENCE system_states_id_seq START WITH 1;
 DROP TABLE IF EXISTS "system_states"; CREATE TABLE "system_states" (